@@ -15,11 +15,10 @@
 package provider
 
 import (
-	"go.opentelemetry.io/contrib/propagators/b3"
-	"go.opentelemetry.io/contrib/propagators/ot"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
@@ -54,8 +53,11 @@ type config struct {
 	resourceDetectors  []resource.Detector
 
 	textMapPropagator propagation.TextMapPropagator
+	propagatorNames   []string
 
-	meterProvider *metric.MeterProvider
+	meterProvider  *metric.MeterProvider
+	metricReaders  []metric.Reader
+	exemplarFilter exemplar.Filter
 }
 
 func newConfig(opts []Option) *config {
@@ -73,12 +75,6 @@ func defaultConfig() *config {
 		enableTracing: true,
 		enableMetrics: true,
 		sampler:       sdktrace.AlwaysSample(),
-		textMapPropagator: propagation.NewCompositeTextMapPropagator(
-			b3.New(),
-			ot.OT{},
-			propagation.Baggage{},
-			propagation.TraceContext{},
-		),
 	}
 }
 
@@ -152,6 +148,14 @@ func WithTextMapPropagator(p propagation.TextMapPropagator) Option {
 	})
 }
 
+// WithPropagators configures the propagators by the names of OTEL_PROPAGATORS,
+// eg: tracecontext, baggage, b3, b3multi, jaeger, xray, ottrace, sw8 and none
+func WithPropagators(names ...string) Option {
+	return option(func(cfg *config) {
+		cfg.propagatorNames = names
+	})
+}
+
 // WithResourceDetector configures resource detector
 func WithResourceDetector(detector resource.Detector) Option {
 	return option(func(cfg *config) {
@@ -200,3 +204,19 @@ func WithMeterProvider(meterProvider *metric.MeterProvider) Option {
 		cfg.meterProvider = meterProvider
 	})
 }
+
+// WithMetricReader configures an extra metric reader besides the otlp exporter,
+// eg: the prometheus exporter. It is ignored when WithMeterProvider is used
+func WithMetricReader(reader metric.Reader) Option {
+	return option(func(cfg *config) {
+		cfg.metricReaders = append(cfg.metricReaders, reader)
+	})
+}
+
+// WithExemplarFilter configures which measurements are offered as exemplars, eg: exemplar.AlwaysOnFilter,
+// exemplar.TraceBasedFilter (the sdk default) or exemplar.AlwaysOffFilter. It is ignored when WithMeterProvider is used
+func WithExemplarFilter(filter exemplar.Filter) Option {
+	return option(func(cfg *config) {
+		cfg.exemplarFilter = filter
+	})
+}
@@ -0,0 +1,132 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"os"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/contrib/propagators/ot"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+// Propagator names, the same as the values of OTEL_PROPAGATORS.
+const (
+	PropagatorTraceContext = "tracecontext"
+	PropagatorBaggage      = "baggage"
+	PropagatorB3           = "b3"
+	PropagatorB3Multi      = "b3multi"
+	PropagatorJaeger       = "jaeger"
+	PropagatorXRay         = "xray"
+	PropagatorOTTrace      = "ottrace"
+	PropagatorSW8          = "sw8"
+	PropagatorNone         = "none"
+)
+
+const propagatorsEnv = "OTEL_PROPAGATORS"
+
+func defaultTextMapPropagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(
+		b3.New(),
+		ot.OT{},
+		propagation.Baggage{},
+		propagation.TraceContext{},
+	)
+}
+
+// textMapPropagator returns the propagator configured by WithTextMapPropagator, WithPropagators
+// or OTEL_PROPAGATORS in order, and falls back to the default propagator.
+func textMapPropagator(cfg *config, res *resource.Resource) propagation.TextMapPropagator {
+	if cfg.textMapPropagator != nil {
+		return cfg.textMapPropagator
+	}
+
+	names := cfg.propagatorNames
+	if len(names) == 0 {
+		if env := os.Getenv(propagatorsEnv); env != "" {
+			names = strings.Split(env, ",")
+		}
+	}
+	if len(names) == 0 {
+		return defaultTextMapPropagator()
+	}
+
+	return propagatorFromNames(names, res)
+}
+
+// propagatorFromNames returns the composite propagator of names, unknown names are ignored,
+// and the default propagator is returned if none of names is known.
+func propagatorFromNames(names []string, res *resource.Resource) propagation.TextMapPropagator {
+	propagators := make([]propagation.TextMapPropagator, 0, len(names))
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case PropagatorTraceContext:
+			propagators = append(propagators, propagation.TraceContext{})
+		case PropagatorBaggage:
+			propagators = append(propagators, propagation.Baggage{})
+		case PropagatorB3:
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case PropagatorB3Multi:
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case PropagatorJaeger:
+			propagators = append(propagators, jaeger.Jaeger{})
+		case PropagatorXRay:
+			propagators = append(propagators, xray.Propagator{})
+		case PropagatorOTTrace:
+			propagators = append(propagators, ot.OT{})
+		case PropagatorSW8:
+			propagators = append(propagators, newSW8(res))
+		case PropagatorNone:
+			return propagation.NewCompositeTextMapPropagator()
+		case "":
+		default:
+			hlog.Warnf("unknown propagator: %s", name)
+		}
+	}
+	if len(propagators) == 0 {
+		hlog.Warnf("no known propagator in %v, use the default propagator", names)
+		return defaultTextMapPropagator()
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...)
+}
+
+// newSW8 returns the sw8 propagator of the service described by res.
+func newSW8(res *resource.Resource) SW8 {
+	var p SW8
+	if res == nil {
+		return p
+	}
+	var hostName string
+	for _, attr := range res.Attributes() {
+		switch attr.Key {
+		case semconv.ServiceNameKey:
+			p.Service = attr.Value.AsString()
+		case semconv.ServiceInstanceIDKey:
+			p.ServiceInstance = attr.Value.AsString()
+		case semconv.HostNameKey:
+			hostName = attr.Value.AsString()
+		}
+	}
+	if p.ServiceInstance == "" {
+		p.ServiceInstance = hostName
+	}
+	return p
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+func TestPropagatorFromNames(t *testing.T) {
+	res := resource.NewSchemaless(
+		semconv.ServiceNameKey.String("order"),
+		semconv.HostNameKey.String("order-1"),
+	)
+
+	p := propagatorFromNames([]string{"tracecontext", " Baggage ", "b3", "b3multi", "jaeger", "xray", "ottrace", "sw8", "unknown"}, res)
+	assert.ElementsMatch(t, []string{
+		"traceparent", "tracestate",
+		"baggage",
+		"b3",
+		"x-b3-traceid", "x-b3-spanid", "x-b3-sampled", "x-b3-flags",
+		"uber-trace-id",
+		"X-Amzn-Trace-Id",
+		"ot-tracer-traceid", "ot-tracer-spanid", "ot-tracer-sampled",
+		"sw8",
+	}, p.Fields())
+
+	assert.Empty(t, propagatorFromNames([]string{"tracecontext", "none"}, res).Fields())
+
+	// unknown names do not disable the propagation
+	assert.ElementsMatch(t, defaultTextMapPropagator().Fields(), propagatorFromNames([]string{"unknown", " "}, res).Fields())
+
+	assert.Equal(t, SW8{Service: "order", ServiceInstance: "order-1"}, newSW8(res))
+}
+
+func TestTextMapPropagator(t *testing.T) {
+	res := resource.Empty()
+
+	// explicit propagator first
+	p := textMapPropagator(newConfig([]Option{
+		WithTextMapPropagator(propagation.TraceContext{}),
+		WithPropagators("jaeger"),
+	}), res)
+	assert.Equal(t, propagation.TraceContext{}, p)
+
+	// then names
+	t.Setenv(propagatorsEnv, "xray")
+	p = textMapPropagator(newConfig([]Option{WithPropagators("jaeger")}), res)
+	assert.Equal(t, []string{"uber-trace-id"}, p.Fields())
+
+	// then the environment variable
+	p = textMapPropagator(newConfig(nil), res)
+	assert.Equal(t, []string{"X-Amzn-Trace-Id"}, p.Fields())
+
+	// then the default propagator
+	t.Setenv(propagatorsEnv, "")
+	p = textMapPropagator(newConfig(nil), res)
+	assert.ElementsMatch(t, defaultTextMapPropagator().Fields(), p.Fields())
+}
@@ -76,7 +76,7 @@ func NewOpenTelemetryProvider(opts ...Option) OtelProvider {
 	res := newResource(cfg)
 
 	// propagator
-	otel.SetTextMapPropagator(cfg.textMapPropagator)
+	otel.SetTextMapPropagator(textMapPropagator(cfg, res))
 
 	// Tracing
 	if cfg.enableTracing {
@@ -148,7 +148,7 @@ func NewOpenTelemetryProvider(opts ...Option) OtelProvider {
 			// reader := metric.NewPeriodicReader(exporter)
 			reader := metric.WithReader(metric.NewPeriodicReader(metricExp, metric.WithInterval(15*time.Second)))
 
-			meterProvider = metric.NewMeterProvider(reader, metric.WithResource(res))
+			meterProvider = metric.NewMeterProvider(append([]metric.Option{reader}, meterProviderOptions(cfg, res)...)...)
 		}
 
 		// metrics pusher
@@ -164,6 +164,18 @@ func NewOpenTelemetryProvider(opts ...Option) OtelProvider {
 	}
 }
 
+// meterProviderOptions returns the options of the default meter provider besides the otlp reader.
+func meterProviderOptions(cfg *config, res *resource.Resource) []metric.Option {
+	opts := []metric.Option{metric.WithResource(res)}
+	for _, reader := range cfg.metricReaders {
+		opts = append(opts, metric.WithReader(reader))
+	}
+	if cfg.exemplarFilter != nil {
+		opts = append(opts, metric.WithExemplarFilter(cfg.exemplarFilter))
+	}
+	return opts
+}
+
 func newResource(cfg *config) *resource.Resource {
 	if cfg.resource != nil {
 		return cfg.resource
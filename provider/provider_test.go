@@ -15,11 +15,16 @@
 package provider
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
 	semconv140 "go.opentelemetry.io/otel/semconv/v1.4.0"
 )
@@ -78,3 +83,38 @@ func Test_newResource(t *testing.T) {
 		})
 	}
 }
+
+func Test_meterProviderOptionsExemplars(t *testing.T) {
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	ctx, span := tracer.Start(context.Background(), "test")
+	defer span.End()
+
+	tests := []struct {
+		name          string
+		filter        exemplar.Filter
+		wantExemplars int
+	}{
+		{name: "always on", filter: exemplar.AlwaysOnFilter, wantExemplars: 1},
+		{name: "always off", filter: exemplar.AlwaysOffFilter, wantExemplars: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := metric.NewManualReader()
+			cfg := newConfig([]Option{WithMetricReader(reader), WithExemplarFilter(tt.filter)})
+			mp := metric.NewMeterProvider(meterProviderOptions(cfg, resource.Default())...)
+
+			histogram, err := mp.Meter("test").Float64Histogram("http.server.duration")
+			assert.NoError(t, err)
+			histogram.Record(ctx, 1)
+
+			var rm metricdata.ResourceMetrics
+			assert.NoError(t, reader.Collect(context.Background(), &rm))
+			dps := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Histogram[float64]).DataPoints
+			assert.Len(t, dps[0].Exemplars, tt.wantExemplars)
+			if tt.wantExemplars > 0 {
+				traceID := span.SpanContext().TraceID()
+				assert.Equal(t, traceID[:], dps[0].Exemplars[0].TraceID)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	sw8Header      = "sw8"
+	sw8FieldCount  = 8
+	sw8Unknown     = "-"
+	sw8HostHeader  = "Host"
+	sw8SampledFlag = "1"
+	sw8DroppedFlag = "0"
+)
+
+var _ propagation.TextMapPropagator = SW8{}
+
+// SW8 propagates span context in the SkyWalking cross process propagation header sw8,
+// ref to https://skywalking.apache.org/docs/main/latest/en/api/x-process-propagation-headers-v3/
+//
+// The trace id and the segment id of OpenTelemetry spans are the hex encoded trace id and
+// span id. SkyWalking ids which are not hex encoded, eg: the ids of the java agent, are hashed
+// into the span context, the original ids are kept in the sw8 entry of the trace state and
+// injected again, so the downstream SkyWalking agents continue the same trace. The ids are lost
+// if the trace state is not propagated, eg: the span context is rebuilt from other headers.
+type SW8 struct {
+	// Service is the parent service of the injected header
+	Service string
+	// ServiceInstance is the parent service instance of the injected header
+	ServiceInstance string
+}
+
+// Inject injects the span context of ctx into the sw8 header of the carrier.
+func (p SW8) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+
+	sample := sw8DroppedFlag
+	if sc.IsSampled() {
+		sample = sw8SampledFlag
+	}
+
+	// the endpoint is the name of the current span if it is known
+	endpoint := sw8Unknown
+	if span, ok := trace.SpanFromContext(ctx).(interface{ Name() string }); ok && span.Name() != "" {
+		endpoint = span.Name()
+	}
+	address := carrier.Get(sw8HostHeader)
+	if address == "" {
+		address = sw8Unknown
+	}
+
+	traceID, segmentID, spanIndex := sc.TraceID().String(), sc.SpanID().String(), 0
+	if orig, ok := sw8OriginFromTraceState(sc.TraceState()); ok {
+		if sw8TraceID(orig.traceID) == sc.TraceID() {
+			traceID = orig.traceID
+		}
+		// the span context is the extracted one, eg: a proxy without span
+		if sw8SpanID(orig.segmentID, orig.spanIndex) == sc.SpanID() {
+			segmentID, spanIndex = orig.segmentID, orig.spanIndex
+		}
+	}
+
+	carrier.Set(sw8Header, strings.Join([]string{
+		sample,
+		sw8Encode(traceID),
+		sw8Encode(segmentID),
+		strconv.Itoa(spanIndex),
+		sw8Encode(orUnknown(p.Service)),
+		sw8Encode(orUnknown(p.ServiceInstance)),
+		sw8Encode(endpoint),
+		sw8Encode(address),
+	}, "-"))
+}
+
+// Extract extracts the span context from the sw8 header of the carrier.
+func (p SW8) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	sc, ok := extractSW8(carrier.Get(sw8Header))
+	if !ok {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Fields returns the keys whose values are set with Inject.
+func (p SW8) Fields() []string {
+	return []string{sw8Header}
+}
+
+func extractSW8(header string) (trace.SpanContext, bool) {
+	fields := strings.Split(header, "-")
+	if len(fields) != sw8FieldCount {
+		return trace.SpanContext{}, false
+	}
+
+	var flags trace.TraceFlags
+	switch fields[0] {
+	case sw8SampledFlag:
+		flags = trace.FlagsSampled
+	case sw8DroppedFlag:
+	default:
+		return trace.SpanContext{}, false
+	}
+
+	traceID, err := sw8Decode(fields[1])
+	if err != nil || traceID == "" {
+		return trace.SpanContext{}, false
+	}
+	segmentID, err := sw8Decode(fields[2])
+	if err != nil || segmentID == "" {
+		return trace.SpanContext{}, false
+	}
+	spanIndex, err := strconv.Atoi(fields[3])
+	if err != nil || spanIndex < 0 {
+		return trace.SpanContext{}, false
+	}
+
+	orig := sw8Origin{traceID: traceID, segmentID: segmentID, spanIndex: spanIndex}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    sw8TraceID(traceID),
+		SpanID:     sw8SpanID(segmentID, spanIndex),
+		TraceFlags: flags,
+		TraceState: orig.traceState(),
+		Remote:     true,
+	})
+	return sc, sc.IsValid()
+}
+
+// sw8TraceStateKey is the key of the trace state entry holding the original SkyWalking ids.
+const sw8TraceStateKey = "sw8"
+
+// sw8Origin is the SkyWalking ids of an extracted span context.
+type sw8Origin struct {
+	traceID   string
+	segmentID string
+	spanIndex int
+}
+
+// traceState returns the trace state holding the ids which are not kept as is in the span
+// context, or an empty trace state.
+func (o sw8Origin) traceState() trace.TraceState {
+	_, traceErr := trace.TraceIDFromHex(o.traceID)
+	_, segmentErr := trace.SpanIDFromHex(o.segmentID)
+	if traceErr == nil && segmentErr == nil && o.spanIndex == 0 {
+		return trace.TraceState{}
+	}
+	ts, err := trace.TraceState{}.Insert(sw8TraceStateKey, strings.Join([]string{
+		base64.RawURLEncoding.EncodeToString([]byte(o.traceID)),
+		base64.RawURLEncoding.EncodeToString([]byte(o.segmentID)),
+		strconv.Itoa(o.spanIndex),
+	}, "."))
+	if err != nil {
+		// the ids are too long for the trace state
+		return trace.TraceState{}
+	}
+	return ts
+}
+
+// sw8OriginFromTraceState returns the SkyWalking ids kept in the trace state.
+func sw8OriginFromTraceState(ts trace.TraceState) (sw8Origin, bool) {
+	fields := strings.Split(ts.Get(sw8TraceStateKey), ".")
+	if len(fields) != 3 {
+		return sw8Origin{}, false
+	}
+	traceID, err := base64.RawURLEncoding.DecodeString(fields[0])
+	if err != nil || len(traceID) == 0 {
+		return sw8Origin{}, false
+	}
+	segmentID, err := base64.RawURLEncoding.DecodeString(fields[1])
+	if err != nil || len(segmentID) == 0 {
+		return sw8Origin{}, false
+	}
+	spanIndex, err := strconv.Atoi(fields[2])
+	if err != nil || spanIndex < 0 {
+		return sw8Origin{}, false
+	}
+	return sw8Origin{traceID: string(traceID), segmentID: string(segmentID), spanIndex: spanIndex}, true
+}
+
+// sw8TraceID returns the trace id of a SkyWalking trace id.
+func sw8TraceID(id string) trace.TraceID {
+	if traceID, err := trace.TraceIDFromHex(id); err == nil {
+		return traceID
+	}
+	var traceID trace.TraceID
+	h := fnv.New128a()
+	_, _ = h.Write([]byte(id))
+	copy(traceID[:], h.Sum(nil))
+	return traceID
+}
+
+// sw8SpanID returns the span id of the span with index spanIndex in a SkyWalking segment.
+func sw8SpanID(segmentID string, spanIndex int) trace.SpanID {
+	if spanIndex == 0 {
+		if spanID, err := trace.SpanIDFromHex(segmentID); err == nil {
+			return spanID
+		}
+	}
+	var spanID trace.SpanID
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(segmentID + "-" + strconv.Itoa(spanIndex)))
+	binary.BigEndian.PutUint64(spanID[:], h.Sum64())
+	return spanID
+}
+
+func sw8Encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func sw8Decode(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	return string(b), err
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return sw8Unknown
+	}
+	return s
+}
@@ -0,0 +1,143 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// headerCarrier carries the context in hertz request headers, the same as the
+// metadataProvider of the tracing package, which is unexported and belongs to the
+// tracing module the provider module does not depend on.
+type headerCarrier struct {
+	headers *protocol.RequestHeader
+}
+
+func (c *headerCarrier) Get(key string) string { return c.headers.Get(key) }
+
+func (c *headerCarrier) Set(key, value string) { c.headers.Set(key, value) }
+
+func (c *headerCarrier) Keys() []string {
+	var keys []string
+	c.headers.VisitAll(func(k, _ []byte) {
+		keys = append(keys, string(k))
+	})
+	return keys
+}
+
+var _ propagation.TextMapCarrier = &headerCarrier{}
+
+const (
+	// hex ids of an OpenTelemetry span
+	sw8OtelHeader = "1-NGJmOTJmMzU3N2IzNGRhNmEzY2U5MjlkMGUwZTQ3MzY=-MDBmMDY3YWEwYmE5MDJiNw==-0-b3JkZXI=-b3JkZXItMQ==-LQ==-YXBpLmV4YW1wbGUuY29t"
+	// ids of a SkyWalking java agent span
+	sw8JavaHeader = "1-YTFiMmMzZDRlNWY2LjEuMTYxODAwMDAwMDAwMDAwMDE=-YTFiMmMzZDRlNWY2LjEuMTYxODAwMDAwMDAwMDAwMDI=-3-cGF5bWVudA==-cGF5bWVudEAxMC4wLjAuMQ==-L2FwaS9wYXk=-MTAuMC4wLjI6ODA4MA=="
+)
+
+func TestSW8Inject(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	headers := &protocol.RequestHeader{}
+	headers.Set("Host", "api.example.com")
+	SW8{Service: "order", ServiceInstance: "order-1"}.Inject(ctx, &headerCarrier{headers: headers})
+
+	assert.Equal(t, sw8OtelHeader, headers.Get("sw8"))
+
+	// invalid span context is not injected
+	headers = &protocol.RequestHeader{}
+	SW8{}.Inject(context.Background(), &headerCarrier{headers: headers})
+	assert.Equal(t, "", headers.Get("sw8"))
+}
+
+func TestSW8Extract(t *testing.T) {
+	extract := func(header string) trace.SpanContext {
+		headers := &protocol.RequestHeader{}
+		headers.Set("sw8", header)
+		return trace.SpanContextFromContext(SW8{}.Extract(context.Background(), &headerCarrier{headers: headers}))
+	}
+
+	sc := extract(sw8OtelHeader)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID().String())
+	assert.True(t, sc.IsSampled())
+	assert.True(t, sc.IsRemote())
+
+	// ids which are not hex encoded are hashed consistently
+	sc = extract(sw8JavaHeader)
+	assert.True(t, sc.IsValid())
+	assert.True(t, sc.IsSampled())
+	assert.Equal(t, sc, extract(sw8JavaHeader))
+	assert.Equal(t, sw8TraceID("a1b2c3d4e5f6.1.16180000000000001"), sc.TraceID())
+	assert.NotEqual(t, sw8SpanID("a1b2c3d4e5f6.1.16180000000000002", 0), sc.SpanID())
+
+	// not sampled
+	sc = extract("0" + sw8OtelHeader[1:])
+	assert.True(t, sc.IsValid())
+	assert.False(t, sc.IsSampled())
+
+	for _, header := range []string{
+		"",
+		"1-NGJm-MDBm",
+		"2" + sw8OtelHeader[1:],
+		"1-!!!-MDBmMDY3YWEwYmE5MDJiNw==-0-b3JkZXI=-b3JkZXItMQ==-LQ==-YXBpLmV4YW1wbGUuY29t",
+		"1-NGJmOTJmMzU3N2IzNGRhNmEzY2U5MjlkMGUwZTQ3MzY=-MDBmMDY3YWEwYmE5MDJiNw==--1-b3JkZXI=-b3JkZXItMQ==-LQ==-YXBpLmV4YW1wbGUuY29t",
+	} {
+		assert.False(t, extract(header).IsValid(), header)
+	}
+}
+
+func TestSW8RoundTrip(t *testing.T) {
+	headers := &protocol.RequestHeader{}
+	headers.Set("sw8", sw8JavaHeader)
+	ctx := SW8{}.Extract(context.Background(), &headerCarrier{headers: headers})
+	fields := strings.Split(sw8JavaHeader, "-")
+
+	// the context is injected as is, eg: by a proxy
+	headers = &protocol.RequestHeader{}
+	SW8{Service: "gateway"}.Inject(ctx, &headerCarrier{headers: headers})
+	injected := strings.Split(headers.Get("sw8"), "-")
+	assert.Equal(t, fields[:4], injected[:4])
+
+	// the span of the service continues the SkyWalking trace in a new segment
+	tp := sdktrace.NewTracerProvider()
+	ctx, span := tp.Tracer("test").Start(ctx, "GET /pay")
+	defer span.End()
+	headers = &protocol.RequestHeader{}
+	SW8{Service: "gateway"}.Inject(ctx, &headerCarrier{headers: headers})
+	injected = strings.Split(headers.Get("sw8"), "-")
+	assert.Equal(t, fields[1], injected[1])
+	assert.Equal(t, sw8Encode(span.SpanContext().SpanID().String()), injected[2])
+	assert.Equal(t, "0", injected[3])
+
+	// the hex ids of OpenTelemetry are not kept in the trace state
+	headers = &protocol.RequestHeader{}
+	headers.Set("sw8", sw8OtelHeader)
+	sc := trace.SpanContextFromContext(SW8{}.Extract(context.Background(), &headerCarrier{headers: headers}))
+	assert.Equal(t, 0, sc.TraceState().Len())
+}
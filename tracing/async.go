@@ -0,0 +1,88 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+
+	"github.com/hertz-contrib/obs-opentelemetry/tracing/internal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Detach returns a background context which carries the span context and the baggage of ctx,
+// but not the cancellation, the deadline or the other values of the request. Use it for the
+// work which outlives the request, eg: goroutines spawned by a handler, since hertz reuses
+// the request context and the server span ends when the response is sent.
+func Detach(ctx context.Context) context.Context {
+	detached := context.Background()
+	if tc := internal.TraceCarrierFromContext(ctx); tc != nil && tc.Tracer() != nil {
+		// keep the tracer of the server, but not the span of the request
+		carrier := &internal.TraceCarrier{}
+		carrier.SetTracer(tc.Tracer())
+		detached = internal.WithTraceCarrier(detached, carrier)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		detached = trace.ContextWithSpanContext(detached, sc)
+	}
+	if bag := baggage.FromContext(ctx); bag.Len() > 0 {
+		detached = baggage.ContextWithBaggage(detached, bag)
+	}
+	return detached
+}
+
+// StartAsyncSpan detaches ctx and starts a span for the background work, the span is a child
+// of the span in ctx. The span must be ended by the background work.
+func StartAsyncSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return StartSpan(Detach(ctx), name, opts...)
+}
+
+// StartLinkedSpan detaches ctx and starts a new root span for the background work, the span
+// is linked to the span in ctx instead of being its child, which suits the work whose
+// duration is unrelated to the request, eg: jobs consumed from a queue.
+func StartLinkedSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	detached := Detach(ctx)
+	if sc := trace.SpanContextFromContext(detached); sc.IsValid() {
+		opts = append([]trace.SpanStartOption{trace.WithLinks(trace.Link{SpanContext: sc})}, opts...)
+	}
+	return StartSpan(detached, name, append(opts, trace.WithNewRoot())...)
+}
+
+// TraceContext is the serialized span context and baggage of a context, it can be stored in
+// the payload of a job, eg: as a json object, and restored by the worker.
+type TraceContext map[string]string
+
+// NewTraceContext serializes the span context and the baggage of ctx with the propagator of c,
+// the global propagator is used if c is nil.
+func NewTraceContext(ctx context.Context, c *Config) TraceContext {
+	tc := TraceContext{}
+	InjectMap(ctx, c, tc)
+	return tc
+}
+
+// Context returns a copy of ctx which carries the span context and the baggage in tc, the span
+// context is remote and can be used as the parent or the link of the span of the job.
+func (tc TraceContext) Context(ctx context.Context, c *Config) context.Context {
+	return propagatorOf(c).Extract(ctx, propagation.MapCarrier(tc))
+}
+
+func propagatorOf(c *Config) propagation.TextMapPropagator {
+	if c == nil || c.textMapPropagator == nil {
+		return otel.GetTextMapPropagator()
+	}
+	return c.textMapPropagator
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type requestKey struct{}
+
+func TestDetach(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	member, _ := baggage.NewMember("user", "alice")
+	bag, _ := baggage.New(member)
+	ctx, cancel := context.WithCancel(baggage.ContextWithBaggage(context.Background(), bag))
+	ctx = context.WithValue(ctx, requestKey{}, "state")
+	ctx, parent := StartSpan(ctx, "request")
+
+	detached := Detach(ctx)
+	cancel()
+	parent.End()
+	assert.Nil(t, detached.Err())
+	assert.Nil(t, detached.Value(requestKey{}))
+	assert.Equal(t, "alice", baggage.FromContext(detached).Member("user").Value())
+	assert.Equal(t, parent.SpanContext(), trace.SpanContextFromContext(detached))
+
+	_, async := StartAsyncSpan(ctx, "async")
+	async.End()
+	_, linked := StartLinkedSpan(ctx, "linked")
+	linked.End()
+
+	spans := sr.Ended()
+	assert.Len(t, spans, 3)
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[1].Parent().SpanID())
+	assert.Equal(t, parent.SpanContext().TraceID(), spans[1].SpanContext().TraceID())
+
+	assert.False(t, spans[2].Parent().IsValid())
+	assert.NotEqual(t, parent.SpanContext().TraceID(), spans[2].SpanContext().TraceID())
+	assert.Len(t, spans[2].Links(), 1)
+	assert.Equal(t, parent.SpanContext(), spans[2].Links()[0].SpanContext)
+}
+
+func TestTraceContext(t *testing.T) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	cfg := newConfig([]Option{WithTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))})
+
+	member, _ := baggage.NewMember("user", "alice")
+	bag, _ := baggage.New(member)
+	ctx, span := StartSpan(baggage.ContextWithBaggage(context.Background(), bag), "request")
+	defer span.End()
+
+	payload, err := json.Marshal(NewTraceContext(ctx, cfg))
+	assert.Nil(t, err)
+
+	var tc TraceContext
+	assert.Nil(t, json.Unmarshal(payload, &tc))
+	restored := tc.Context(context.Background(), cfg)
+	sc := trace.SpanContextFromContext(restored)
+	assert.True(t, sc.IsRemote())
+	assert.Equal(t, span.SpanContext().TraceID(), sc.TraceID())
+	assert.Equal(t, span.SpanContext().SpanID(), sc.SpanID())
+	assert.Equal(t, "alice", baggage.FromContext(restored).Member("user").Value())
+}
@@ -0,0 +1,179 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+const headerXForwardedFor = "X-Forwarded-For"
+
+var (
+	basicAuthPrefix = []byte("Basic ")
+	httpsScheme     = []byte("https")
+)
+
+// httpRequestAttributes returns the net, enduser and http attributes of the request.
+// It reads the hertz request directly instead of converting it to a *http.Request
+// for the semconv helpers, which copies the headers and the body of every request.
+func httpRequestAttributes(req *protocol.Request, transport, version, route string) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, 16)
+
+	// net attributes
+	attrs = append(attrs, netTransport(transport))
+	hostIP, hostName, hostPort := hostIPNamePort(string(req.Host()))
+	if hostIP != "" {
+		attrs = append(attrs, semconv.NetHostIPKey.String(hostIP))
+	}
+	if hostName != "" {
+		attrs = append(attrs, semconv.NetHostNameKey.String(hostName))
+	}
+	if hostPort != 0 {
+		attrs = append(attrs, semconv.NetHostPortKey.Int(hostPort))
+	}
+
+	// enduser attributes
+	if username, ok := basicAuthUsername(req.Header.Peek(consts.HeaderAuthorization)); ok {
+		attrs = append(attrs, semconv.EnduserIDKey.String(username))
+	}
+
+	// http attributes
+	attrs = append(attrs, semconv.HTTPTargetKey.String(string(req.URI().RequestURI())))
+	if route != "" {
+		attrs = append(attrs, semconv.HTTPRouteKey.String(route))
+	}
+	if forwardedFor := req.Header.Peek(headerXForwardedFor); len(forwardedFor) > 0 {
+		if i := bytes.IndexByte(forwardedFor, ','); i > 0 {
+			forwardedFor = forwardedFor[:i]
+		}
+		attrs = append(attrs, semconv.HTTPClientIPKey.String(string(forwardedFor)))
+	}
+	if ua := req.Header.UserAgent(); len(ua) > 0 {
+		attrs = append(attrs, semconv.HTTPUserAgentKey.String(string(ua)))
+	}
+	if contentLength := requestBodySize(req); contentLength > 0 {
+		attrs = append(attrs, semconv.HTTPRequestContentLengthKey.Int(contentLength))
+	}
+	if bytes.Equal(req.URI().Scheme(), httpsScheme) {
+		attrs = append(attrs, semconv.HTTPSchemeHTTPS)
+	} else {
+		attrs = append(attrs, semconv.HTTPSchemeHTTP)
+	}
+	if host := req.Host(); len(host) > 0 {
+		attrs = append(attrs, semconv.HTTPHostKey.String(string(host)))
+	}
+	if flavor, ok := httpFlavor(version); ok {
+		attrs = append(attrs, flavor)
+	}
+	if method := req.Header.Method(); len(method) > 0 {
+		attrs = append(attrs, semconv.HTTPMethodKey.String(string(method)))
+	} else {
+		attrs = append(attrs, semconv.HTTPMethodKey.String(consts.MethodGet))
+	}
+
+	return attrs
+}
+
+func netTransport(network string) attribute.KeyValue {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return semconv.NetTransportTCP
+	case "udp", "udp4", "udp6":
+		return semconv.NetTransportUDP
+	case "ip", "ip4", "ip6":
+		return semconv.NetTransportIP
+	case "unix", "unixgram", "unixpacket":
+		return semconv.NetTransportUnix
+	default:
+		return semconv.NetTransportOther
+	}
+}
+
+// hostIPNamePort extracts the ip address, name and (optional) port from hostWithPort.
+func hostIPNamePort(hostWithPort string) (ip, name string, port int) {
+	hostPart, portPart, err := net.SplitHostPort(hostWithPort)
+	if err != nil {
+		hostPart, portPart = hostWithPort, ""
+	}
+	if parsedIP := net.ParseIP(hostPart); parsedIP != nil {
+		ip = parsedIP.String()
+	} else {
+		name = hostPart
+	}
+	if parsedPort, err := strconv.ParseUint(portPart, 10, 16); err == nil {
+		port = int(parsedPort)
+	}
+	return
+}
+
+// basicAuthUsername returns the username of a basic authorization header.
+func basicAuthUsername(auth []byte) (string, bool) {
+	if len(auth) < len(basicAuthPrefix) || !bytes.EqualFold(auth[:len(basicAuthPrefix)], basicAuthPrefix) {
+		return "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(string(auth[len(basicAuthPrefix):]))
+	if err != nil {
+		return "", false
+	}
+	username, _, ok := bytes.Cut(decoded, []byte{':'})
+	if !ok {
+		return "", false
+	}
+	return string(username), true
+}
+
+// headerAttributeKey returns the attribute key of the captured header, eg:
+// http.request.header.x_request_id
+func headerAttributeKey(prefix, header string) attribute.Key {
+	return attribute.Key(prefix + strings.ToLower(strings.ReplaceAll(header, "-", "_")))
+}
+
+// headerAttributes returns the captured request and response headers of the server request.
+func (cfg *Config) headerAttributes(c *app.RequestContext) []attribute.KeyValue {
+	if len(cfg.requestHeaders) == 0 && len(cfg.responseHeaders) == 0 {
+		return nil
+	}
+
+	attrs := make([]attribute.KeyValue, 0, len(cfg.requestHeaders)+len(cfg.responseHeaders))
+	for _, header := range cfg.requestHeaders {
+		if values := c.Request.Header.PeekAll(header.name); len(values) > 0 {
+			attrs = append(attrs, header.key.StringSlice(bytesToStrings(values)))
+		}
+	}
+	for _, header := range cfg.responseHeaders {
+		if values := c.Response.Header.PeekAll(header.name); len(values) > 0 {
+			attrs = append(attrs, header.key.StringSlice(bytesToStrings(values)))
+		}
+	}
+	return attrs
+}
+
+func bytesToStrings(values [][]byte) []string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = string(v)
+	}
+	return s
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/common/adaptor"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+func newAttributesTestRequest() *protocol.Request {
+	req := protocol.NewRequest(consts.MethodPost, "http://127.0.0.1:8080/ping?foo=bar", nil)
+	req.SetBodyString(`{"message":"ping"}`)
+	req.Header.SetUserAgentBytes([]byte("hertz-test"))
+	req.Header.Set(consts.HeaderAuthorization, "Basic "+base64.StdEncoding.EncodeToString([]byte("user:pass")))
+	req.Header.Set(headerXForwardedFor, "10.0.0.1, 10.0.0.2")
+	req.Header.Set("X-Custom", "custom")
+	return req
+}
+
+// compatRequestAttributes is how the attributes were extracted before, through adaptor.GetCompatRequest.
+func compatRequestAttributes(req *protocol.Request, route string) []attribute.KeyValue {
+	httpReq, err := adaptor.GetCompatRequest(req)
+	if err != nil {
+		return nil
+	}
+	attrs := semconv.NetAttributesFromHTTPRequest("tcp", httpReq)
+	attrs = append(attrs, semconv.EndUserAttributesFromHTTPRequest(httpReq)...)
+	return append(attrs, semconv.HTTPServerAttributesFromHTTPRequest("", route, httpReq)...)
+}
+
+func TestHTTPRequestAttributes(t *testing.T) {
+	req := newAttributesTestRequest()
+
+	attrs := httpRequestAttributes(req, "tcp", "1.1", "/ping")
+
+	// same as the attributes extracted by the semconv helpers, except http.target
+	// which is left empty by the converted request.
+	for _, want := range compatRequestAttributes(req, "/ping") {
+		if want.Key == semconv.HTTPTargetKey {
+			continue
+		}
+		assert.Contains(t, attrs, want)
+	}
+	assert.Contains(t, attrs, semconv.HTTPTargetKey.String("/ping?foo=bar"))
+	assert.Contains(t, attrs, semconv.EnduserIDKey.String("user"))
+	assert.Contains(t, attrs, semconv.HTTPClientIPKey.String("10.0.0.1"))
+	assert.Contains(t, attrs, semconv.NetHostIPKey.String("127.0.0.1"))
+	assert.Contains(t, attrs, semconv.NetHostPortKey.Int(8080))
+}
+
+func TestHTTPRequestAttributesScheme(t *testing.T) {
+	req := protocol.NewRequest(consts.MethodGet, "https://example.com/ping", nil)
+
+	attrs := httpRequestAttributes(req, "tcp", "2", "")
+	assert.Contains(t, attrs, semconv.HTTPSchemeHTTPS)
+	assert.Contains(t, attrs, semconv.HTTPFlavorHTTP20)
+	assert.Contains(t, attrs, semconv.NetHostNameKey.String("example.com"))
+	assert.Contains(t, attrs, semconv.HTTPHostKey.String("example.com"))
+}
+
+func TestBasicAuthUsername(t *testing.T) {
+	encode := func(s string) []byte {
+		return []byte("Basic " + base64.StdEncoding.EncodeToString([]byte(s)))
+	}
+
+	username, ok := basicAuthUsername(encode("user:pass"))
+	assert.True(t, ok)
+	assert.Equal(t, "user", username)
+
+	_, ok = basicAuthUsername(encode("user"))
+	assert.False(t, ok)
+	_, ok = basicAuthUsername([]byte("Bearer token"))
+	assert.False(t, ok)
+	_, ok = basicAuthUsername([]byte("Basic !!!"))
+	assert.False(t, ok)
+	_, ok = basicAuthUsername(nil)
+	assert.False(t, ok)
+}
+
+func BenchmarkHTTPRequestAttributes(b *testing.B) {
+	req := newAttributesTestRequest()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = httpRequestAttributes(req, "tcp", "1.1", "/ping")
+	}
+}
+
+func BenchmarkCompatRequestAttributes(b *testing.B) {
+	req := newAttributesTestRequest()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = compatRequestAttributes(req, "/ping")
+	}
+}
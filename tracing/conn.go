@@ -0,0 +1,143 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+
+	hnetpoll "github.com/cloudwego/hertz/pkg/network/netpoll"
+	"github.com/cloudwego/netpoll"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+type connStateKey struct{}
+
+// connState is the state of a server connection, kept in the context of the connection.
+type connState struct {
+	accepted time.Time
+	// requests is the number of the requests finished on the connection
+	requests int64
+	// lastFinish is the end of the last request in unix nanoseconds, 0 before the first one
+	lastFinish int64
+}
+
+func connStateFromContext(ctx context.Context) *connState {
+	cs, _ := ctx.Value(connStateKey{}).(*connState)
+	return cs
+}
+
+// connMeasures are the http.server.connection.* instruments.
+type connMeasures struct {
+	open     metric.Int64UpDownCounter
+	duration metric.Float64Histogram
+	requests metric.Int64Histogram
+}
+
+func createConnMeasures(meter metric.Meter) *connMeasures {
+	open, err := meter.Int64UpDownCounter(
+		ServerConnectionOpen,
+		metric.WithUnit("{connection}"),
+		metric.WithDescription("measures the number of open connections"),
+	)
+	handleErr(err)
+
+	duration, err := meter.Float64Histogram(
+		ServerConnectionDuration,
+		metric.WithUnit("ms"),
+		metric.WithDescription("measures the duration of connections from accept to close"),
+	)
+	handleErr(err)
+
+	requests, err := meter.Int64Histogram(
+		ServerConnectionRequests,
+		metric.WithUnit("{request}"),
+		metric.WithDescription("measures the number of requests served by a connection"),
+	)
+	handleErr(err)
+
+	return &connMeasures{open: open, duration: duration, requests: requests}
+}
+
+// onAccept returns the server.WithOnAccept callback which keeps the state of the connection
+// in its context, next is the OnAccept configured before.
+func (m *connMeasures) onAccept(next func(conn net.Conn) context.Context) func(conn net.Conn) context.Context {
+	return func(conn net.Conn) context.Context {
+		ctx := context.Background()
+		if next != nil {
+			ctx = next(conn)
+		}
+
+		cs := &connState{accepted: time.Now()}
+		// the connection metrics are only recorded when the close is known
+		if onConnClose(conn, func() { m.closed(cs) }) {
+			m.open.Add(context.Background(), 1)
+		}
+
+		return context.WithValue(ctx, connStateKey{}, cs)
+	}
+}
+
+func (m *connMeasures) closed(cs *connState) {
+	ctx := context.Background()
+	m.open.Add(ctx, -1)
+	m.duration.Record(ctx, float64(time.Since(cs.accepted))/float64(time.Millisecond))
+	m.requests.Record(ctx, atomic.LoadInt64(&cs.requests))
+}
+
+// onConnClose registers fn to be called when conn is closed, it reports false if the
+// transport does not support close callbacks.
+func onConnClose(conn net.Conn, fn func()) bool {
+	c, ok := conn.(*hnetpoll.Conn)
+	if !ok {
+		return false
+	}
+	nc, ok := c.Conn.(netpoll.Connection)
+	if !ok {
+		return false
+	}
+	return nc.AddCloseCallback(func(netpoll.Connection) error {
+		fn()
+		return nil
+	}) == nil
+}
+
+// requestFinished counts the request on the connection and returns the attributes of the
+// connection timing, start and end are the times of the request.
+func (cs *connState) requestFinished(start, end time.Time) []attribute.KeyValue {
+	requests := atomic.AddInt64(&cs.requests, 1)
+
+	idleSince := cs.accepted
+	if last := atomic.SwapInt64(&cs.lastFinish, end.UnixNano()); last != 0 {
+		idleSince = time.Unix(0, last)
+	}
+
+	return []attribute.KeyValue{
+		ConnReusedKey.Bool(requests > 1),
+		ConnRequestsKey.Int64(requests),
+		ConnIdleDurationKey.Float64(nonNegativeMilliseconds(start.Sub(idleSince))),
+		ConnAgeKey.Float64(nonNegativeMilliseconds(start.Sub(cs.accepted))),
+	}
+}
+
+func nonNegativeMilliseconds(d time.Duration) float64 {
+	if d < 0 {
+		return 0
+	}
+	return float64(d) / float64(time.Millisecond)
+}
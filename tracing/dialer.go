@@ -0,0 +1,358 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/network"
+)
+
+var _ network.Dialer = (*tracingDialer)(nil)
+
+// tracingDialer wraps a network.Dialer and records the connection phases
+// (dns resolution, connect and tls handshake) of every dialed connection.
+type tracingDialer struct {
+	dialer   network.Dialer
+	resolver *net.Resolver
+}
+
+// resolvingDialers are the packages of the dialers which resolve the host with the
+// default resolver, the tracing dialer resolves the host for them to time the lookup.
+var resolvingDialers = map[string]bool{
+	"github.com/cloudwego/hertz/pkg/network/standard": true,
+	"github.com/cloudwego/hertz/pkg/network/netpoll":  true,
+}
+
+// NewDialer returns a network.Dialer which records connection phase timing
+// for ClientMiddleware. Use it with client.WithDialer, eg:
+//
+//	c, _ := client.NewClient(client.WithDialer(tracing.NewDialer(standard.NewDialer())))
+//	c.Use(tracing.ClientMiddleware())
+//
+// The dns resolution is only timed for the standard and netpoll dialers of hertz, which
+// are passed the resolved ips. Other dialers are passed the address as is, so their own
+// resolution or routing applies, and the dns resolution is part of the connect phase.
+func NewDialer(dialer network.Dialer) network.Dialer {
+	d := &tracingDialer{dialer: dialer}
+	if t := reflect.TypeOf(dialer); t != nil {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if resolvingDialers[t.PkgPath()] {
+			d.resolver = net.DefaultResolver
+		}
+	}
+	return d
+}
+
+func (d *tracingDialer) DialConnection(n, address string, timeout time.Duration, tlsConfig *tls.Config) (network.Conn, error) {
+	dt := &dialTrace{}
+
+	deadline := time.Now().Add(timeout)
+	addrs, err := d.resolve(address, timeout, dt)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn network.Conn
+	dt.connectStart = time.Now()
+	for _, addr := range addrs {
+		dialTimeout := timeout
+		if timeout > 0 {
+			dialTimeout = time.Until(deadline)
+		}
+		conn, err = d.dialer.DialConnection(n, addr, dialTimeout, nil)
+		if err == nil {
+			break
+		}
+	}
+	dt.connectDone = time.Now()
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig != nil {
+		dt.tlsStart = time.Now()
+		conn, err = d.dialer.AddTLS(conn, tlsConfig)
+		dt.tlsDone = time.Now()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &tracedConn{Conn: conn, dial: dt}, nil
+}
+
+func (d *tracingDialer) DialTimeout(network, address string, timeout time.Duration, tlsConfig *tls.Config) (net.Conn, error) {
+	return d.dialer.DialTimeout(network, address, timeout, tlsConfig)
+}
+
+func (d *tracingDialer) AddTLS(conn network.Conn, tlsConfig *tls.Config) (network.Conn, error) {
+	tc, ok := conn.(*tracedConn)
+	if !ok {
+		return d.dialer.AddTLS(conn, tlsConfig)
+	}
+
+	// the connection goes through a proxy, handshake with the inner connection
+	// and keep the dial trace of the tunnel.
+	tc.dial.tlsStart = time.Now()
+	inner, err := d.dialer.AddTLS(tc.Conn, tlsConfig)
+	tc.dial.tlsDone = time.Now()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tracedConn{Conn: inner, dial: tc.dial}, nil
+}
+
+// resolve looks up the host of address and returns the addresses to dial.
+// Addresses which already contain an ip, or addresses dialed by a dialer
+// which resolves them itself, are returned as is.
+func (d *tracingDialer) resolve(address string, timeout time.Duration, dt *dialTrace) ([]string, error) {
+	if d.resolver == nil {
+		return []string{address}, nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return []string{address}, nil
+	}
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	dt.dnsStart = time.Now()
+	ips, err := d.resolver.LookupHost(ctx, host)
+	dt.dnsDone = time.Now()
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.JoinHostPort(ip, port))
+	}
+	return addrs, nil
+}
+
+// dialTrace holds the timing of dialing a connection.
+type dialTrace struct {
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+}
+
+// connTrace holds the timing of a single request sent over a traced connection.
+type connTrace struct {
+	// dial is only set for the first request sent over a new connection
+	dial      *dialTrace
+	reused    bool
+	gotConn   time.Time
+	wroteReq  time.Time
+	firstByte time.Time
+}
+
+type roundTrip struct {
+	mu    sync.Mutex
+	trace connTrace
+}
+
+func (rt *roundTrip) snapshot() connTrace {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.trace
+}
+
+// maxRoundTrips is the number of round trips a traced connection keeps, the
+// next request may start on a released connection before the middleware of
+// the previous one reads its round trip.
+const maxRoundTrips = 4
+
+// tracedConns maps the remote address of the connections to the traced
+// connections, hertz client stores the address in the response so
+// ClientMiddleware can find the connection of the request.
+var tracedConns sync.Map
+
+type tracedConn struct {
+	network.Conn
+
+	dial *dialTrace
+
+	mu         sync.Mutex
+	addr       net.Addr
+	roundTrips []*roundTrip
+}
+
+// startRoundTrip is called before writing, a request sent after the response
+// of the previous one is read starts a new round trip.
+func (c *tracedConn) startRoundTrip() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if n := len(c.roundTrips); n > 0 {
+		last := c.roundTrips[n-1]
+		last.mu.Lock()
+		reading := !last.trace.firstByte.IsZero()
+		last.mu.Unlock()
+		if !reading {
+			return
+		}
+	}
+
+	rt := &roundTrip{trace: connTrace{gotConn: time.Now()}}
+	if len(c.roundTrips) == 0 {
+		rt.trace.dial = c.dial
+		c.register()
+	} else {
+		rt.trace.reused = true
+	}
+	if len(c.roundTrips) == maxRoundTrips {
+		c.roundTrips = append(c.roundTrips[:0], c.roundTrips[1:]...)
+	}
+	c.roundTrips = append(c.roundTrips, rt)
+}
+
+// register makes the connection findable by its remote address, only the
+// addresses held by pointer identify a single connection.
+func (c *tracedConn) register() {
+	addr := c.Conn.RemoteAddr()
+	if addr == nil || reflect.TypeOf(addr).Kind() != reflect.Ptr {
+		return
+	}
+	c.addr = addr
+	tracedConns.Store(addr, c)
+}
+
+func (c *tracedConn) Malloc(n int) ([]byte, error) {
+	c.startRoundTrip()
+	return c.Conn.Malloc(n)
+}
+
+func (c *tracedConn) WriteBinary(b []byte) (int, error) {
+	c.startRoundTrip()
+	return c.Conn.WriteBinary(b)
+}
+
+func (c *tracedConn) Write(b []byte) (int, error) {
+	c.startRoundTrip()
+	return c.Conn.Write(b)
+}
+
+func (c *tracedConn) Flush() error {
+	c.startRoundTrip()
+	err := c.Conn.Flush()
+	if rt := c.roundTrip(); rt != nil {
+		rt.mu.Lock()
+		if rt.trace.wroteReq.IsZero() {
+			rt.trace.wroteReq = time.Now()
+		}
+		rt.mu.Unlock()
+	}
+	return err
+}
+
+func (c *tracedConn) Peek(n int) ([]byte, error) {
+	b, err := c.Conn.Peek(n)
+	if err == nil {
+		if rt := c.roundTrip(); rt != nil {
+			rt.mu.Lock()
+			if rt.trace.firstByte.IsZero() && !rt.trace.wroteReq.IsZero() {
+				rt.trace.firstByte = time.Now()
+			}
+			rt.mu.Unlock()
+		}
+	}
+	return b, err
+}
+
+func (c *tracedConn) Close() error {
+	c.mu.Lock()
+	if c.addr != nil {
+		tracedConns.CompareAndDelete(c.addr, c)
+	}
+	c.mu.Unlock()
+	return c.Conn.Close()
+}
+
+// ToHertzError implements the network.ErrorNormalization interface.
+func (c *tracedConn) ToHertzError(err error) error {
+	if errNorm, ok := c.Conn.(network.ErrorNormalization); ok {
+		return errNorm.ToHertzError(err)
+	}
+	return err
+}
+
+// roundTrip returns the current round trip of the connection.
+func (c *tracedConn) roundTrip() *roundTrip {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n := len(c.roundTrips); n > 0 {
+		return c.roundTrips[n-1]
+	}
+	return nil
+}
+
+// roundTripOf returns the round trip of the request which ran from start to end. The
+// requests sent over a connection do not overlap, and a request may wait for the
+// connection while the previous one is sent over it, so it is the latest round trip
+// started within the request whose response started before end, or without a response,
+// eg: the request failed, the latest round trip started within the request.
+func (c *tracedConn) roundTripOf(start, end time.Time) *roundTrip {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var started *roundTrip
+	for i := len(c.roundTrips) - 1; i >= 0; i-- {
+		rt := c.roundTrips[i]
+		rt.mu.Lock()
+		trace := rt.trace
+		rt.mu.Unlock()
+		if trace.gotConn.Before(start) || trace.gotConn.After(end) {
+			continue
+		}
+		if !trace.firstByte.IsZero() && !trace.firstByte.After(end) {
+			return rt
+		}
+		if started == nil {
+			started = rt
+		}
+	}
+	return started
+}
+
+// connTraceFromAddr returns the timing recorded by a traced connection for
+// the request which ran from start to end, whose response holds the remote address addr.
+func connTraceFromAddr(addr net.Addr, start, end time.Time) (connTrace, bool) {
+	if addr == nil || reflect.TypeOf(addr).Kind() != reflect.Ptr {
+		return connTrace{}, false
+	}
+	v, ok := tracedConns.Load(addr)
+	if !ok {
+		return connTrace{}, false
+	}
+	if rt := v.(*tracedConn).roundTripOf(start, end); rt != nil {
+		return rt.snapshot(), true
+	}
+	return connTrace{}, false
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/app/client/discovery"
+	"github.com/cloudwego/hertz/pkg/app/client/loadbalance"
+	"github.com/cloudwego/hertz/pkg/app/middlewares/client/sd"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type discoveryStateKey struct{}
+
+type discoveryState struct {
+	start  time.Time
+	picked bool
+}
+
+// Discovery returns the service discovery middleware of sd.Discovery which records the resolver,
+// the balancer and the discovery latency (resolve and pick) on the client span. Use it after
+// ClientMiddleware, eg:
+//
+//	c.Use(tracing.ClientMiddleware(), tracing.Discovery(resolver))
+func Discovery(resolver discovery.Resolver, opts ...sd.ServiceDiscoveryOption) client.Middleware {
+	options := &sd.ServiceDiscoveryOptions{
+		Balancer: loadbalance.NewWeightedBalancer(),
+		Resolver: resolver,
+	}
+	options.Apply(opts)
+
+	attrs := []attribute.KeyValue{
+		DiscoveryResolverKey.String(options.Resolver.Name()),
+		DiscoveryBalancerKey.String(options.Balancer.Name()),
+	}
+	discoveryMiddleware := sd.Discovery(resolver, opts...)
+
+	return func(next client.Endpoint) client.Endpoint {
+		// picked is called once the instance is picked and set as the host of the request
+		picked := discoveryMiddleware(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+			if state, ok := ctx.Value(discoveryStateKey{}).(*discoveryState); ok {
+				state.picked = true
+				trace.SpanFromContext(ctx).SetAttributes(
+					DiscoveryInstanceKey.String(string(req.Host())),
+					DiscoveryLatencyKey.Float64(float64(time.Since(state.start))/float64(time.Millisecond)),
+				)
+			}
+			return next(ctx, req, resp)
+		})
+
+		return func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+			if req.Options() == nil || !req.Options().IsSD() {
+				return next(ctx, req, resp)
+			}
+
+			span := trace.SpanFromContext(ctx)
+			span.SetAttributes(attrs...)
+
+			state := &discoveryState{start: time.Now()}
+			err := picked(context.WithValue(ctx, discoveryStateKey{}, state), req, resp)
+			if !state.picked {
+				span.SetAttributes(DiscoveryLatencyKey.Float64(float64(time.Since(state.start)) / float64(time.Millisecond)))
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/app/client/discovery"
+	"github.com/cloudwego/hertz/pkg/app/middlewares/client/sd"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func staticResolver(name string, addrs ...string) discovery.Resolver {
+	return &discovery.SynthesizedResolver{
+		TargetFunc: func(ctx context.Context, target *discovery.TargetInfo) string {
+			return target.Host
+		},
+		ResolveFunc: func(ctx context.Context, key string) (discovery.Result, error) {
+			if len(addrs) == 0 {
+				return discovery.Result{}, errors.New("no instance of " + key)
+			}
+			instances := make([]discovery.Instance, 0, len(addrs))
+			for _, addr := range addrs {
+				instances = append(instances, discovery.NewInstance("tcp", addr, 10, nil))
+			}
+			return discovery.Result{CacheKey: key, Instances: instances}, nil
+		},
+		NameFunc: func() string { return name },
+	}
+}
+
+func doDiscoveryRequest(t *testing.T, middlewares ...client.Middleware) (sdktrace.ReadOnlySpan, error) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	endpoint := func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		resp.SetStatusCode(200)
+		return nil
+	}
+	chain := append([]client.Middleware{ClientMiddleware()}, middlewares...)
+	for i := len(chain) - 1; i >= 0; i-- {
+		endpoint = chain[i](endpoint)
+	}
+
+	req, resp := protocol.AcquireRequest(), protocol.AcquireResponse()
+	defer protocol.ReleaseRequest(req)
+	defer protocol.ReleaseResponse(resp)
+	req.SetRequestURI("http://user-service/user/1")
+	req.SetOptions(config.WithSD(true))
+
+	err := endpoint(context.Background(), req, resp)
+	spans := sr.Ended()
+	assert.Len(t, spans, 1)
+	return spans[0], err
+}
+
+func attributeValue(attrs []attribute.KeyValue, key attribute.Key) (attribute.Value, bool) {
+	for _, attr := range attrs {
+		if attr.Key == key {
+			return attr.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestClientMiddlewareDiscovery(t *testing.T) {
+	span, err := doDiscoveryRequest(t, Discovery(staticResolver("static", "10.0.0.1:8888")))
+	assert.Nil(t, err)
+
+	attrs := span.Attributes()
+	assert.True(t, hasAttribute(attrs, DiscoveryServiceKey.String("user-service")))
+	assert.True(t, hasAttribute(attrs, DiscoveryInstanceKey.String("10.0.0.1:8888")))
+	assert.True(t, hasAttribute(attrs, DiscoveryResolverKey.String("static")))
+	assert.True(t, hasAttribute(attrs, DiscoveryBalancerKey.String("weight_random")))
+	latency, ok := attributeValue(attrs, DiscoveryLatencyKey)
+	assert.True(t, ok)
+	assert.GreaterOrEqual(t, latency.AsFloat64(), float64(0))
+
+	// the instance is recorded with the sd middleware of hertz too
+	span, err = doDiscoveryRequest(t, sd.Discovery(staticResolver("static-sd", "10.0.0.2:8888")))
+	assert.Nil(t, err)
+	assert.True(t, hasAttribute(span.Attributes(), DiscoveryServiceKey.String("user-service")))
+	assert.True(t, hasAttribute(span.Attributes(), DiscoveryInstanceKey.String("10.0.0.2:8888")))
+}
+
+func TestClientMiddlewareDiscoveryError(t *testing.T) {
+	span, err := doDiscoveryRequest(t, Discovery(staticResolver("empty")))
+	assert.NotNil(t, err)
+
+	attrs := span.Attributes()
+	assert.True(t, hasAttribute(attrs, DiscoveryServiceKey.String("user-service")))
+	assert.True(t, hasAttribute(attrs, DiscoveryResolverKey.String("empty")))
+	_, ok := attributeValue(attrs, DiscoveryInstanceKey)
+	assert.False(t, ok)
+	_, ok = attributeValue(attrs, DiscoveryLatencyKey)
+	assert.True(t, ok)
+}
@@ -15,6 +15,8 @@
 package tracing
 
 import (
+	"time"
+
 	"github.com/cloudwego/hertz/pkg/common/tracer/stats"
 	"github.com/cloudwego/hertz/pkg/common/tracer/traceinfo"
 	"go.opentelemetry.io/otel/attribute"
@@ -48,3 +50,33 @@ func injectStatsEventsToSpan(span trace.Span, st traceinfo.HTTPStats) {
 		}
 	}
 }
+
+// injectConnTraceEventsToSpan records the client connection phases as span events.
+func injectConnTraceEventsToSpan(span trace.Span, ct connTrace, end time.Time) {
+	if dt := ct.dial; dt != nil {
+		addPhaseEvents(span, "dns", dt.dnsStart, dt.dnsDone)
+		addPhaseEvents(span, "connect", dt.connectStart, dt.connectDone)
+		addPhaseEvents(span, "tls_handshake", dt.tlsStart, dt.tlsDone)
+	}
+	if !ct.gotConn.IsZero() {
+		span.AddEvent("got_conn",
+			trace.WithTimestamp(ct.gotConn),
+			trace.WithAttributes(ConnReusedKey.Bool(ct.reused)),
+		)
+	}
+	if !ct.wroteReq.IsZero() {
+		span.AddEvent("wrote_request", trace.WithTimestamp(ct.wroteReq))
+	}
+	if !ct.firstByte.IsZero() {
+		span.AddEvent("got_first_response_byte", trace.WithTimestamp(ct.firstByte))
+		span.AddEvent("read_response_finish", trace.WithTimestamp(end))
+	}
+}
+
+func addPhaseEvents(span trace.Span, phase string, start, done time.Time) {
+	if start.IsZero() || done.IsZero() {
+		return
+	}
+	span.AddEvent(phase+"_start", trace.WithTimestamp(start))
+	span.AddEvent(phase+"_done", trace.WithTimestamp(done))
+}
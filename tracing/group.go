@@ -0,0 +1,81 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// groupConfigKey is the key of the config of the route group in the RequestContext keys.
+const groupConfigKey = "github.com/hertz-contrib/obs-opentelemetry/tracing.group_config"
+
+// GroupMiddleware returns the middleware of a route group which overrides the config of
+// the server tracer, cfg is the config returned by NewServerTracer. The server span of the
+// requests of the group is started by this middleware with the options of cfg and opts,
+// ServerMiddleware of the engine leaves the requests to it, so there is one server span, eg:
+//
+//	tracer, cfg := tracing.NewServerTracer()
+//	h := server.Default(tracer)
+//	h.Use(tracing.ServerMiddleware(cfg))
+//	admin := h.Group("/admin", tracing.GroupMiddleware(cfg, tracing.WithShouldIgnore(ignoreHealth)))
+//
+// The innermost group middleware wins when the route groups are nested.
+func GroupMiddleware(cfg *Config, opts ...Option) app.HandlerFunc {
+	groupCfg := newConfig(append(cfg.opts[:len(cfg.opts):len(cfg.opts)], opts...))
+	return groupMiddleware(groupCfg)
+}
+
+func groupMiddleware(cfg *Config) app.HandlerFunc {
+	fallback := &fallbackTracer{cfg: cfg}
+	return func(ctx context.Context, c *app.RequestContext) {
+		if hasGroupMiddleware(c) {
+			c.Next(ctx)
+			return
+		}
+		c.Set(groupConfigKey, cfg)
+		serve(ctx, c, cfg, fallback)
+	}
+}
+
+// groupMiddlewarePC is the code pointer shared by all the group middlewares.
+var groupMiddlewarePC uintptr
+
+func init() {
+	groupMiddlewarePC = reflect.ValueOf(groupMiddleware(nil)).Pointer()
+}
+
+// hasGroupMiddleware reports whether a group middleware is after the current handler.
+func hasGroupMiddleware(c *app.RequestContext) bool {
+	handlers := c.Handlers()
+	for i := int(c.GetIndex()) + 1; i < len(handlers); i++ {
+		if reflect.ValueOf(handlers[i]).Pointer() == groupMiddlewarePC {
+			return true
+		}
+	}
+	return false
+}
+
+// requestConfig returns the config of the route group of the request, or cfg.
+func requestConfig(c *app.RequestContext, cfg *Config) *Config {
+	if v, ok := c.Get(groupConfigKey); ok {
+		if groupCfg, ok := v.(*Config); ok {
+			return groupCfg
+		}
+	}
+	return cfg
+}
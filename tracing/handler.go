@@ -0,0 +1,137 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/utils"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HandlerTracingMode decides how the handlers after ServerMiddleware are traced.
+type HandlerTracingMode int
+
+const (
+	// HandlerTracingDisabled does not trace the handlers, the default.
+	HandlerTracingDisabled HandlerTracingMode = iota
+	// HandlerTracingSpans wraps every handler in an internal child span named by the handler.
+	HandlerTracingSpans
+	// HandlerTracingEvents adds a "handler" event with the handler name and duration to the server span.
+	HandlerTracingEvents
+)
+
+// maxHandlerChains is the max number of traced handler chains kept in the cache, the chains
+// of the routes are static, the chains built per request are traced without the cache.
+const maxHandlerChains = 4096
+
+// handlerChainKey identifies the handlers after the current one of a handler chain.
+type handlerChainKey struct {
+	first *app.HandlerFunc
+	len   int
+	next  int
+	mode  HandlerTracingMode
+}
+
+// handlerChainCache holds the traced handler chains of the routes.
+type handlerChainCache struct {
+	mu     sync.RWMutex
+	chains map[handlerChainKey]app.HandlersChain
+}
+
+func newHandlerChainCache() *handlerChainCache {
+	return &handlerChainCache{chains: make(map[handlerChainKey]app.HandlersChain)}
+}
+
+// traceHandlers replaces the handlers after the current one with the traced handlers,
+// the returned func restores the original handlers once the chain is done.
+func (cache *handlerChainCache) traceHandlers(c *app.RequestContext, mode HandlerTracingMode) (restore func()) {
+	handlers := c.Handlers()
+	next := int(c.GetIndex()) + 1
+	if next >= len(handlers) {
+		return func() {}
+	}
+
+	key := handlerChainKey{first: &handlers[0], len: len(handlers), next: next, mode: mode}
+	cache.mu.RLock()
+	traced, ok := cache.chains[key]
+	cache.mu.RUnlock()
+	if !ok {
+		traced = tracedHandlerChain(handlers, next, mode)
+		cache.mu.Lock()
+		if len(cache.chains) < maxHandlerChains {
+			cache.chains[key] = traced
+		}
+		cache.mu.Unlock()
+	}
+	c.SetHandlers(traced)
+
+	return func() {
+		c.SetHandlers(handlers)
+	}
+}
+
+// tracedHandlerChain returns a copy of handlers whose handlers from next are traced. The main
+// handler stays the last one, so HandlerName and Handler keep returning it, and is traced by
+// an extra handler before it.
+func tracedHandlerChain(handlers app.HandlersChain, next int, mode HandlerTracingMode) app.HandlersChain {
+	last := len(handlers) - 1
+	traced := make(app.HandlersChain, 0, len(handlers)+1)
+	traced = append(traced, handlers[:next]...)
+	for i := next; i < last; i++ {
+		traced = append(traced, tracedHandler(handlers[i], utils.NameOfFunction(handlers[i]), mode))
+	}
+	// the extra handler calls the main handler with Next
+	traced = append(traced, tracedHandler(func(ctx context.Context, c *app.RequestContext) {
+		c.Next(ctx)
+	}, utils.NameOfFunction(handlers[last]), mode), handlers[last])
+	return traced
+}
+
+func tracedHandler(handler app.HandlerFunc, name string, mode HandlerTracingMode) app.HandlerFunc {
+	if mode == HandlerTracingSpans {
+		return handlerWithSpan(handler, name)
+	}
+	return handlerWithEvent(handler, name)
+}
+
+func handlerWithSpan(handler app.HandlerFunc, name string) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		ctx, span := StartSpan(ctx, name, trace.WithAttributes(HandlerNameKey.String(name)))
+		defer span.End()
+
+		handler(ctx, c)
+	}
+}
+
+func handlerWithEvent(handler app.HandlerFunc, name string) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		start := time.Now()
+		defer func() {
+			SpanFromRequestContext(c).AddEvent("handler",
+				trace.WithTimestamp(start),
+				trace.WithAttributes(
+					HandlerNameKey.String(name),
+					HandlerDurationKey.Float64(float64(time.Since(start))/float64(time.Millisecond)),
+				),
+			)
+		}()
+
+		handler(ctx, c)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// Instrument traces the requests of h, call it before registering the routes, eg:
+//
+//	h := server.Default()
+//	tracing.Instrument(h)
+//
+// ServerMiddleware is registered as the first middleware. The tracer of NewServerTracer is
+// optional: if h is created with it, the config of the tracer is used and returned, and opts
+// must be passed to NewServerTracer instead, otherwise the spans are finished by the middleware,
+// without the events and timings of the request stats. The wiring is checked when h starts.
+func Instrument(h *server.Hertz, opts ...Option) *Config {
+	var cfg *Config
+	if st := serverTracerOf(h); st != nil {
+		if len(opts) > 0 {
+			hlog.Warnf("HERTZ: the server is created with tracing.NewServerTracer, the %d options of tracing.Instrument are ignored, pass them to tracing.NewServerTracer", len(opts))
+		}
+		cfg = st.config
+	} else {
+		cfg = newConfig(opts)
+	}
+
+	if len(h.Routes()) > 0 {
+		hlog.Warnf("HERTZ: tracing.Instrument is called after registering %d routes, the routes are not traced", len(h.Routes()))
+	}
+	h.Handlers = append(app.HandlersChain{ServerMiddleware(cfg)}, h.Handlers...)
+	// rebuild the handlers of 404 and 405 with the middleware
+	h.Use()
+
+	h.OnRun = append(h.OnRun, func(ctx context.Context) error {
+		diagnose(h)
+		return nil
+	})
+
+	return cfg
+}
+
+// serverMiddlewarePC is the code pointer shared by all the server middlewares.
+var serverMiddlewarePC uintptr
+
+func init() {
+	serverMiddlewarePC = reflect.ValueOf(ServerMiddleware(nil)).Pointer()
+}
+
+// serverTracerOf returns the tracer of NewServerTracer which h is created with.
+func serverTracerOf(h *server.Hertz) *serverTracer {
+	for _, t := range h.GetOptions().Tracers {
+		if st, ok := t.(*serverTracer); ok {
+			return st
+		}
+	}
+	return nil
+}
+
+// diagnose logs the problems of the tracing setup of h once it starts.
+func diagnose(h *server.Hertz) {
+	if serverTracerOf(h) == nil {
+		hlog.Infof("HERTZ: the server is created without tracing.NewServerTracer, the server spans are finished by ServerMiddleware without the request stats")
+	}
+
+	var middlewares int
+	for _, handler := range h.Handlers {
+		if reflect.ValueOf(handler).Pointer() == serverMiddlewarePC {
+			middlewares++
+		}
+	}
+	if middlewares > 1 {
+		hlog.Warnf("HERTZ: ServerMiddleware is registered %d times, the requests are traced more than once", middlewares)
+	}
+}
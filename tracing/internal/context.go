@@ -27,6 +27,8 @@ var traceCarrierContextKey traceCarrierContextKeyType
 type TraceCarrier struct {
 	tracer oteltrace.Tracer
 	span   oteltrace.Span
+	// stream holds the recorder of a streaming response
+	stream interface{}
 }
 
 func WithTraceCarrier(ctx context.Context, tc *TraceCarrier) context.Context {
@@ -56,3 +58,11 @@ func (t *TraceCarrier) Span() oteltrace.Span {
 func (t *TraceCarrier) SetSpan(span oteltrace.Span) {
 	t.span = span
 }
+
+func (t *TraceCarrier) Stream() interface{} {
+	return t.stream
+}
+
+func (t *TraceCarrier) SetStream(stream interface{}) {
+	t.stream = stream
+}
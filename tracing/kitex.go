@@ -0,0 +1,76 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+
+	"github.com/bytedance/gopkg/cloud/metainfo"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+// kitexPeerServiceHeaders are the headers of the peer service keys of kitex obs-opentelemetry,
+// which are metainfo transient values named by the semconv keys, eg: rpc-transit-service.name
+var kitexPeerServiceHeaders = PeerServiceHeaders{
+	ServiceName:           metainfo.HTTPPrefixTransient + metainfo.CGIVariableToHTTPHeader(string(semconv.ServiceNameKey)),
+	ServiceNamespace:      metainfo.HTTPPrefixTransient + metainfo.CGIVariableToHTTPHeader(string(semconv.ServiceNamespaceKey)),
+	DeploymentEnvironment: metainfo.HTTPPrefixTransient + metainfo.CGIVariableToHTTPHeader(string(semconv.DeploymentEnvironmentKey)),
+}
+
+var (
+	_ metainfo.HTTPHeaderCarrier = metainfoHeaders{}
+	_ metainfo.HTTPHeaderSetter  = metainfoHeaders{}
+)
+
+// metainfoHeaders adapts the hertz headers to the metainfo HTTP header carrier.
+type metainfoHeaders struct {
+	headers headers
+}
+
+// Visit visits all headers, the first value of a repeated header is visited
+func (h metainfoHeaders) Visit(v func(k, v string)) {
+	visited := make(map[string]struct{})
+	h.headers.VisitAll(func(key, value []byte) {
+		if _, ok := visited[string(key)]; ok {
+			return
+		}
+		visited[string(key)] = struct{}{}
+		v(string(key), string(value))
+	})
+}
+
+// Set sets the header by k/v
+func (h metainfoHeaders) Set(key, value string) {
+	h.headers.Set(key, value)
+}
+
+// metainfoFromRequest returns ctx with the metainfo of the rpc-transit- and rpc-persist- request headers,
+// the transient values are visible to the handler and not forwarded, as kitex servers do.
+func metainfoFromRequest(ctx context.Context, headers *protocol.RequestHeader) context.Context {
+	return metainfo.TransferForward(metainfo.FromHTTPHeader(ctx, metainfoHeaders{headers: headers}))
+}
+
+// metainfoToRequest writes the transient and persistent metainfo of ctx into the request headers,
+// the transient values received from the upstream are not forwarded.
+func metainfoToRequest(ctx context.Context, headers *protocol.RequestHeader) {
+	metainfo.ToHTTPHeader(metainfo.TransferForward(ctx), metainfoHeaders{headers: headers})
+}
+
+// kitexPeerServiceAttributes returns the peer service attributes of the kitex peer service keys.
+func kitexPeerServiceAttributes(headers *protocol.RequestHeader) []attribute.KeyValue {
+	return extractPeerServiceAttributesFromMetadata(headers, kitexPeerServiceHeaders)
+}
@@ -0,0 +1,125 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bytedance/gopkg/cloud/metainfo"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+func TestServerKitexCompatibility(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider())
+
+	tracer, cfg := NewServerTracer(
+		WithKitexCompatibility(true),
+		WithTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})),
+	)
+	h := server.New(tracer, server.WithHostPorts("127.0.0.1:26683"))
+	h.Use(ServerMiddleware(cfg))
+
+	type received struct {
+		tenant, caller, member string
+		transient              bool
+	}
+	ch := make(chan received, 1)
+	h.GET("/ping", func(c context.Context, ctx *app.RequestContext) {
+		var r received
+		r.tenant, _ = metainfo.GetPersistentValue(c, "TENANT_ID")
+		r.caller, _ = metainfo.GetValue(c, "CALLER")
+		r.member = baggage.FromContext(c).Member("user").Value()
+		// the transient values of the upstream are not forwarded to the kitex clients
+		_, r.transient = metainfo.GetAllValues(metainfo.TransferForward(c))["CALLER"]
+		ch <- r
+		ctx.String(200, "pong")
+	})
+	go h.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1:26683/ping", nil)
+	assert.Nil(t, err)
+	req.Header.Set("rpc-persist-tenant-id", "acme")
+	req.Header.Set("rpc-transit-caller", "gateway")
+	req.Header.Set("rpc-transit-service.name", "kitex-client")
+	req.Header.Set("baggage", "user=alice")
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+
+	r := <-ch
+	assert.Equal(t, "acme", r.tenant)
+	assert.Equal(t, "gateway", r.caller)
+	assert.Equal(t, "alice", r.member)
+	assert.False(t, r.transient)
+
+	time.Sleep(50 * time.Millisecond)
+
+	spans := sr.Ended()
+	assert.Len(t, spans, 1)
+	assert.True(t, hasAttribute(spans[0].Attributes(), semconv.PeerServiceKey.String("kitex-client")))
+}
+
+func TestClientKitexCompatibility(t *testing.T) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	ctx := metainfo.WithValue(context.Background(), "UPSTREAM", "kitex")
+	// received from the upstream
+	ctx = metainfo.TransferForward(ctx)
+	ctx = metainfo.WithValue(ctx, "CALLER", "gateway")
+	ctx = metainfo.WithPersistentValue(ctx, "TENANT_ID", "acme")
+
+	var header protocol.RequestHeader
+	endpoint := ClientMiddleware(WithKitexCompatibility(true))(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		req.Header.CopyTo(&header)
+		return nil
+	})
+
+	req, resp := protocol.AcquireRequest(), protocol.AcquireResponse()
+	defer protocol.ReleaseRequest(req)
+	defer protocol.ReleaseResponse(resp)
+	req.SetRequestURI("http://127.0.0.1/ping")
+	assert.Nil(t, endpoint(ctx, req, resp))
+
+	assert.Equal(t, "gateway", header.Get("rpc-transit-caller"))
+	assert.Equal(t, "acme", header.Get("rpc-persist-tenant-id"))
+	assert.Equal(t, "", header.Get("rpc-transit-upstream"))
+
+	// the metainfo is not written without the compatibility
+	header.Reset()
+	endpoint = ClientMiddleware()(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		req.Header.CopyTo(&header)
+		return nil
+	})
+	req.Header.Del("rpc-transit-caller")
+	req.Header.Del("rpc-persist-tenant-id")
+	assert.Nil(t, endpoint(ctx, req, resp))
+	assert.Equal(t, "", header.Get("rpc-transit-caller"))
+}
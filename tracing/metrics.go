@@ -15,7 +15,13 @@
 package tracing
 
 import (
+	"context"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/tracer/stats"
+	"github.com/cloudwego/hertz/pkg/common/tracer/traceinfo"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
 	oteltrace "go.opentelemetry.io/otel/trace"
@@ -25,12 +31,50 @@ import (
 const (
 	ServerRequestCount = "http.server.request_count" // measures the incoming request count total
 	ServerLatency      = "http.server.duration"      // measures th incoming end to end duration
+	ServerRequestSize  = "http.server.request_size"  // measures the size of incoming request bodies
+	ServerResponseSize = "http.server.response_size" // measures the size of outgoing response bodies
+)
+
+// Server HTTP stream metrics, when WithStreamTracing is enabled, streaming responses are recorded
+// in ServerStreamDuration instead of ServerLatency
+const (
+	ServerStreamDuration = "http.server.stream_duration" // measures the duration of streaming responses and hijacked connections
+)
+
+// Server HTTP timing breakdown metrics, recorded when WithServerTimingMetrics is enabled
+// and the server runs with stats.LevelDetailed trace level.
+const (
+	ServerReadHeaderLatency = "http.server.read_header_duration" // measures the duration of reading the request header
+	ServerReadBodyLatency   = "http.server.read_body_duration"   // measures the duration of reading the request body
+	ServerHandleLatency     = "http.server.handle_duration"      // measures the duration of handler execution
+	ServerWriteLatency      = "http.server.write_duration"       // measures the duration of writing the response
+)
+
+// Server HTTP connection metrics, recorded when WithConnectionMetrics is enabled
+// and the server runs with the netpoll transport.
+const (
+	ServerConnectionOpen     = "http.server.connection.open"     // measures the number of open connections
+	ServerConnectionDuration = "http.server.connection.duration" // measures the duration of connections from accept to close
+	ServerConnectionRequests = "http.server.connection.requests" // measures the number of requests served by a connection
 )
 
 // Client HTTP metrics.
 const (
 	ClientRequestCount = "http.client.request_count" // measures the client request count total
 	ClientLatency      = "http.client.duration"      // measures the duration outbound HTTP requests
+	ClientRequestSize  = "http.client.request_size"  // measures the size of outbound request bodies
+	ClientResponseSize = "http.client.response_size" // measures the size of received response bodies
+)
+
+// Client HTTP connection phase metrics, recorded when WithClientPhaseMetrics is enabled
+// and the client uses the dialer returned by NewDialer.
+const (
+	ClientDNSLatency         = "http.client.dns_duration"           // measures the duration of dns resolution
+	ClientConnectLatency     = "http.client.connect_duration"       // measures the duration of establishing a new connection
+	ClientTLSLatency         = "http.client.tls_handshake_duration" // measures the duration of tls handshake
+	ClientConnAcquireLatency = "http.client.conn_acquire_duration"  // measures the duration of getting a connection from the pool or dialing
+	ClientFirstByteLatency   = "http.client.time_to_first_byte"     // measures the duration from writing the request to the first response byte
+	ClientBodyReadLatency    = "http.client.response_read_duration" // measures the duration from the first response byte to the response read
 )
 
 var (
@@ -39,6 +83,7 @@ var (
 		semconv.HTTPRouteKey,
 		semconv.HTTPMethodKey,
 		semconv.HTTPStatusCodeKey,
+		NetworkProtocolVersionKey,
 	}
 
 	PeerMetricsAttributes = []attribute.Key{
@@ -101,3 +146,85 @@ func matchAttributeKey(key attribute.Key, toMatchKeys []attribute.Key) bool {
 	}
 	return false
 }
+
+// serverTimingPhases maps the server timing histograms to the stats events they are computed from.
+var serverTimingPhases = []struct {
+	name        string
+	description string
+	start       stats.Event
+	finish      stats.Event
+}{
+	{ServerReadHeaderLatency, "measures the duration of reading the request header", stats.ReadHeaderStart, stats.ReadHeaderFinish},
+	{ServerReadBodyLatency, "measures the duration of reading the request body", stats.ReadBodyStart, stats.ReadBodyFinish},
+	{ServerHandleLatency, "measures the duration of handler execution", stats.ServerHandleStart, stats.ServerHandleFinish},
+	{ServerWriteLatency, "measures the duration of writing the response", stats.WriteStart, stats.WriteFinish},
+}
+
+// createServerTimingMeasures returns the server timing histograms in the order of serverTimingPhases.
+func createServerTimingMeasures(meter metric.Meter) []metric.Float64Histogram {
+	histograms := make([]metric.Float64Histogram, 0, len(serverTimingPhases))
+	for _, phase := range serverTimingPhases {
+		h, err := meter.Float64Histogram(
+			phase.name,
+			metric.WithUnit("ms"),
+			metric.WithDescription(phase.description),
+		)
+		handleErr(err)
+		histograms = append(histograms, h)
+	}
+	return histograms
+}
+
+func recordServerTimingMetrics(ctx context.Context, histograms []metric.Float64Histogram, st traceinfo.HTTPStats, opt metric.RecordOption) {
+	for i, phase := range serverTimingPhases {
+		start, finish := st.GetEvent(phase.start), st.GetEvent(phase.finish)
+		if start == nil || finish == nil {
+			continue
+		}
+		histograms[i].Record(ctx, float64(finish.Time().Sub(start.Time()))/float64(time.Millisecond), opt)
+	}
+}
+
+func createClientPhaseMeasures(meter metric.Meter, histogramRecorder map[string]metric.Float64Histogram) {
+	phases := []struct {
+		name        string
+		description string
+	}{
+		{ClientDNSLatency, "measures the duration of dns resolution"},
+		{ClientConnectLatency, "measures the duration of establishing a new connection"},
+		{ClientTLSLatency, "measures the duration of tls handshake"},
+		{ClientConnAcquireLatency, "measures the duration of getting a connection from the pool or dialing"},
+		{ClientFirstByteLatency, "measures the duration from writing the request to the first response byte"},
+		{ClientBodyReadLatency, "measures the duration from the first response byte to the response read"},
+	}
+
+	for _, phase := range phases {
+		h, err := meter.Float64Histogram(
+			phase.name,
+			metric.WithUnit("ms"),
+			metric.WithDescription(phase.description),
+		)
+		handleErr(err)
+		histogramRecorder[phase.name] = h
+	}
+}
+
+func recordClientPhaseMetrics(ctx context.Context, histogramRecorder map[string]metric.Float64Histogram, ct connTrace, start, end time.Time, attrs []attribute.KeyValue) {
+	record := func(name string, from, to time.Time) {
+		if from.IsZero() || to.IsZero() {
+			return
+		}
+		histogramRecorder[name].Record(ctx, float64(to.Sub(from))/float64(time.Millisecond), metric.WithAttributes(attrs...))
+	}
+
+	if dt := ct.dial; dt != nil {
+		record(ClientDNSLatency, dt.dnsStart, dt.dnsDone)
+		record(ClientConnectLatency, dt.connectStart, dt.connectDone)
+		record(ClientTLSLatency, dt.tlsStart, dt.tlsDone)
+	}
+	record(ClientConnAcquireLatency, start, ct.gotConn)
+	record(ClientFirstByteLatency, ct.wroteReq, ct.firstByte)
+	if !ct.firstByte.IsZero() {
+		record(ClientBodyReadLatency, ct.firstByte, end)
+	}
+}
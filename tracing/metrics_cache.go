@@ -0,0 +1,143 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// maxMetricsAttributeSets bounds the number of cached attribute sets, the
+	// metrics attributes of high cardinality are not cached once it is reached.
+	maxMetricsAttributeSets = 1024
+	// maxMetricsAttributeSlots is the max number of span attributes which identify a set.
+	maxMetricsAttributeSlots = 16
+)
+
+var metricsAttributesPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]attribute.KeyValue, 0, maxMetricsAttributeSlots)
+		return &buf
+	},
+}
+
+// metricsAttributesKey identifies the metrics attributes of a span. Every metrics
+// attribute key has a fixed slot, so the key does not depend on the order of the
+// span attributes.
+type metricsAttributesKey struct {
+	res   *resource.Resource
+	attrs [maxMetricsAttributeSlots]attribute.KeyValue
+}
+
+// metricsAttributesCache caches the attribute sets of the repeated combinations of
+// route, method, status and peer, so the set is not rebuilt for every request.
+type metricsAttributesCache struct {
+	mu   sync.RWMutex
+	opts map[metricsAttributesKey]metric.MeasurementOption
+}
+
+func newMetricsAttributesCache() *metricsAttributesCache {
+	return &metricsAttributesCache{
+		opts: make(map[metricsAttributesKey]metric.MeasurementOption),
+	}
+}
+
+// measurementOption returns the measurement option holding the metrics attributes of
+// the span, the same attributes as extractMetricsAttributesFromSpan.
+func (c *metricsAttributesCache) measurementOption(span oteltrace.Span) metric.MeasurementOption {
+	readOnlySpan, ok := span.(trace.ReadOnlySpan)
+	if !ok {
+		return metric.WithAttributeSet(*attribute.EmptySet())
+	}
+
+	slots := len(HTTPMetricsAttributes) + len(PeerMetricsAttributes) + 1
+	if slots > maxMetricsAttributeSlots {
+		return metric.WithAttributes(extractMetricsAttributesFromSpan(span)...)
+	}
+
+	key := metricsAttributesKey{res: readOnlySpan.Resource()}
+	for _, attr := range readOnlySpan.Attributes() {
+		if i := metricsAttributeSlot(attr.Key); i >= 0 {
+			key.attrs[i] = attr
+		}
+	}
+	key.attrs[slots-1] = StatusKey.String(readOnlySpan.Status().Code.String())
+
+	c.mu.RLock()
+	opt, ok := c.opts[key]
+	c.mu.RUnlock()
+	if ok {
+		return opt
+	}
+
+	opt = metric.WithAttributeSet(newMetricsAttributeSet(&key))
+
+	c.mu.Lock()
+	if len(c.opts) < maxMetricsAttributeSets {
+		c.opts[key] = opt
+	}
+	c.mu.Unlock()
+
+	return opt
+}
+
+// newMetricsAttributeSet builds the attribute set of the key with a pooled buffer.
+func newMetricsAttributeSet(key *metricsAttributesKey) attribute.Set {
+	bufp := metricsAttributesPool.Get().(*[]attribute.KeyValue)
+	buf := (*bufp)[:0]
+
+	for _, attr := range key.attrs {
+		if attr.Key != "" {
+			buf = append(buf, attr)
+		}
+	}
+	if key.res != nil {
+		for _, attr := range key.res.Attributes() {
+			if matchAttributeKey(attr.Key, MetricResourceAttributes) {
+				buf = append(buf, attr)
+			}
+		}
+	}
+
+	// NewSet copies the attributes, the buffer can be reused.
+	set := attribute.NewSet(buf...)
+
+	*bufp = buf[:0]
+	metricsAttributesPool.Put(bufp)
+
+	return set
+}
+
+// metricsAttributeSlot returns the slot of a metrics attribute key, or -1 if the
+// key is not a metrics attribute.
+func metricsAttributeSlot(key attribute.Key) int {
+	for i, k := range HTTPMetricsAttributes {
+		if k == key {
+			return i
+		}
+	}
+	for i, k := range PeerMetricsAttributes {
+		if k == key {
+			return len(HTTPMetricsAttributes) + i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func newMetricsCacheTestTracer() oteltrace.Tracer {
+	res := resource.NewSchemaless(
+		semconv.ServiceNameKey.String("hertz-server"),
+		semconv.HostNameKey.String("localhost"),
+		attribute.String("ignored", "ignored"),
+	)
+	return sdktrace.NewTracerProvider(sdktrace.WithResource(res)).Tracer("test")
+}
+
+func startMetricsCacheTestSpan(tracer oteltrace.Tracer, attrs ...attribute.KeyValue) oteltrace.Span {
+	_, span := tracer.Start(context.Background(), "test", oteltrace.WithAttributes(attrs...))
+	return span
+}
+
+func measurementAttributes(opt metric.MeasurementOption) attribute.Set {
+	return metric.NewAddConfig([]metric.AddOption{opt}).Attributes()
+}
+
+func TestMetricsAttributesCache(t *testing.T) {
+	tracer := newMetricsCacheTestTracer()
+	cache := newMetricsAttributesCache()
+
+	span := startMetricsCacheTestSpan(tracer,
+		semconv.HTTPRouteKey.String("/ping"),
+		semconv.HTTPMethodKey.String("GET"),
+		semconv.HTTPStatusCodeKey.Int(200),
+		semconv.HTTPTargetKey.String("/ping?id=1"),
+	)
+	span.SetStatus(codes.Error, "")
+
+	want := attribute.NewSet(extractMetricsAttributesFromSpan(span)...)
+	got := measurementAttributes(cache.measurementOption(span))
+	assert.True(t, want.Equals(&got), got.Encoded(attribute.DefaultEncoder()))
+	assert.Len(t, cache.opts, 1)
+
+	// the order of span attributes does not matter
+	span = startMetricsCacheTestSpan(tracer,
+		semconv.HTTPTargetKey.String("/ping?id=2"),
+		semconv.HTTPStatusCodeKey.Int(200),
+		semconv.HTTPMethodKey.String("GET"),
+		semconv.HTTPRouteKey.String("/ping"),
+	)
+	span.SetStatus(codes.Error, "")
+	got = measurementAttributes(cache.measurementOption(span))
+	assert.True(t, want.Equals(&got), got.Encoded(attribute.DefaultEncoder()))
+	assert.Len(t, cache.opts, 1)
+
+	// a different status is another set
+	span = startMetricsCacheTestSpan(tracer,
+		semconv.HTTPRouteKey.String("/ping"),
+		semconv.HTTPMethodKey.String("GET"),
+		semconv.HTTPStatusCodeKey.Int(200),
+	)
+	got = measurementAttributes(cache.measurementOption(span))
+	assert.False(t, want.Equals(&got))
+	assert.Len(t, cache.opts, 2)
+}
+
+func TestMetricsAttributesCacheLimit(t *testing.T) {
+	tracer := newMetricsCacheTestTracer()
+	cache := newMetricsAttributesCache()
+
+	for i := 0; i < maxMetricsAttributeSets+10; i++ {
+		span := startMetricsCacheTestSpan(tracer, semconv.HTTPRouteKey.String("/"+strconv.Itoa(i)))
+		got := measurementAttributes(cache.measurementOption(span))
+		route, _ := got.Value(semconv.HTTPRouteKey)
+		assert.Equal(t, "/"+strconv.Itoa(i), route.AsString())
+	}
+	assert.Len(t, cache.opts, maxMetricsAttributeSets)
+}
+
+func TestMetricsAttributesCacheConcurrent(t *testing.T) {
+	tracer := newMetricsCacheTestTracer()
+	cache := newMetricsAttributesCache()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				span := startMetricsCacheTestSpan(tracer,
+					semconv.HTTPRouteKey.String("/"+strconv.Itoa(i%8)),
+					semconv.HTTPMethodKey.String("GET"),
+					semconv.HTTPStatusCodeKey.Int(200+g%4),
+				)
+				want := attribute.NewSet(extractMetricsAttributesFromSpan(span)...)
+				got := measurementAttributes(cache.measurementOption(span))
+				if !want.Equals(&got) {
+					t.Errorf("unexpected attributes: %s", got.Encoded(attribute.DefaultEncoder()))
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	assert.Len(t, cache.opts, 32)
+}
+
+func BenchmarkMetricsAttributesCache(b *testing.B) {
+	tracer := newMetricsCacheTestTracer()
+	cache := newMetricsAttributesCache()
+	span := startMetricsCacheTestSpan(tracer,
+		semconv.HTTPRouteKey.String("/ping"),
+		semconv.HTTPMethodKey.String("GET"),
+		semconv.HTTPStatusCodeKey.Int(200),
+	)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = cache.measurementOption(span)
+		}
+	})
+}
+
+func BenchmarkExtractMetricsAttributes(b *testing.B) {
+	tracer := newMetricsCacheTestTracer()
+	span := startMetricsCacheTestSpan(tracer,
+		semconv.HTTPRouteKey.String("/ping"),
+		semconv.HTTPMethodKey.String("GET"),
+		semconv.HTTPStatusCodeKey.Int(200),
+	)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = metric.WithAttributes(extractMetricsAttributesFromSpan(span)...)
+		}
+	})
+}
@@ -16,13 +16,13 @@ package tracing
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/app/client"
-	"github.com/cloudwego/hertz/pkg/common/adaptor"
-	"github.com/cloudwego/hertz/pkg/common/hlog"
 	"github.com/cloudwego/hertz/pkg/common/tracer/stats"
+	"github.com/cloudwego/hertz/pkg/network"
 	"github.com/cloudwego/hertz/pkg/protocol"
 	"github.com/hertz-contrib/obs-opentelemetry/tracing/internal"
 	"go.opentelemetry.io/otel/attribute"
@@ -63,8 +63,28 @@ func ClientMiddleware(opts ...Option) client.Middleware {
 	)
 	handleErr(err)
 
+	clientRequestSizeMeasure, err := cfg.meter.Float64Histogram(
+		ClientRequestSize,
+		metric.WithUnit("By"),
+		metric.WithDescription("measures the size of outbound request bodies"),
+	)
+	handleErr(err)
+
+	clientResponseSizeMeasure, err := cfg.meter.Float64Histogram(
+		ClientResponseSize,
+		metric.WithUnit("By"),
+		metric.WithDescription("measures the size of received response bodies"),
+	)
+	handleErr(err)
+
 	counters[ClientRequestCount] = clientRequestCountMeasure
 	histogramRecorder[ClientLatency] = clientLatencyMeasure
+	histogramRecorder[ClientRequestSize] = clientRequestSizeMeasure
+	histogramRecorder[ClientResponseSize] = clientResponseSizeMeasure
+
+	if cfg.clientPhaseMetrics {
+		createClientPhaseMeasures(cfg.meter, histogramRecorder)
+	}
 
 	return func(next client.Endpoint) client.Endpoint {
 		return func(ctx context.Context, req *protocol.Request, resp *protocol.Response) (err error) {
@@ -74,44 +94,83 @@ func ClientMiddleware(opts ...Option) client.Middleware {
 
 			start := time.Now()
 
-			// trace start
-			ctx, span := cfg.tracer.Start(
-				ctx,
-				cfg.clientSpanNameFormatter(req),
+			// the host is resolved by the service discovery middleware in next,
+			// so the service name is the host before calling next
+			host := hostWithoutPort(string(req.Host()))
+
+			startOpts := []oteltrace.SpanStartOption{
 				oteltrace.WithTimestamp(start),
 				oteltrace.WithSpanKind(oteltrace.SpanKindClient),
-			)
-			defer span.End()
+			}
+			if peerService := cfg.clientPeerService(req, host); peerService != "" {
+				startOpts = append(startOpts, oteltrace.WithAttributes(semconv.PeerServiceKey.String(peerService)))
+			}
 
-			// inject client service resource attributes (canonical service) to meta map
-			md := injectPeerServiceToMetadata(ctx, span.(trace.ReadOnlySpan).Resource().Attributes())
+			// trace start
+			ctx, span := cfg.tracer.Start(ctx, cfg.clientSpanNameFormatter(req), startOpts...)
+			defer span.End()
 
 			Inject(ctx, cfg, &req.Header)
+			if cfg.kitexCompatibility {
+				metainfoToRequest(ctx, &req.Header)
+			}
 
-			for k, v := range md {
-				req.Header.Set(k, v)
+			// inject client service resource attributes (canonical service) to meta map
+			if readOnlySpan, ok := span.(trace.ReadOnlySpan); ok && cfg.shouldPropagatePeerService(host) {
+				md := injectPeerServiceToMetadata(ctx, readOnlySpan.Resource().Attributes(), cfg.peerServiceHeaders)
+				for k, v := range md {
+					req.Header.Set(k, v)
+				}
 			}
 
 			err = next(ctx, req, resp)
+			end := time.Now()
+
+			// the service discovery middleware replaces the service name with the instance address
+			if req.Options() != nil && req.Options().IsSD() {
+				span.SetAttributes(DiscoveryServiceKey.String(host))
+				if instance := string(req.Host()); hostWithoutPort(instance) != host {
+					span.SetAttributes(DiscoveryInstanceKey.String(instance))
+				}
+			}
 
 			// end span
-			if httpReq, err := adaptor.GetCompatRequest(req); err == nil {
-				span.SetAttributes(semconv.NetAttributesFromHTTPRequest("tcp", httpReq)...)
-				span.SetAttributes(semconv.EndUserAttributesFromHTTPRequest(httpReq)...)
-				span.SetAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", cfg.clientHttpRouteFormatter(req), httpReq)...)
+			span.SetAttributes(httpRequestAttributes(req, transportTCP, parseHTTPVersion(req.Header.GetProtocol()), cfg.clientHttpRouteFormatter(req))...)
+
+			// connection phases recorded by the tracing dialer
+			ct, traced := connTraceFromAddr(resp.RemoteAddr(), start, end)
+			if traced {
+				span.SetAttributes(ConnReusedKey.Bool(ct.reused))
+				injectConnTraceEventsToSpan(span, ct, end)
 			}
 
 			// span attributes
+			wroteBytes, readBytes := requestBodySize(req), 0
 			attrs := []attribute.KeyValue{
 				semconv.HTTPURLKey.String(req.URI().String()),
 			}
+			if wroteBytes > 0 {
+				attrs = append(attrs, WroteBytesKey.Int(wroteBytes))
+			}
 
 			if err == nil {
 				// set span status with resp status code
-				span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(resp.StatusCode()))
+				span.SetStatus(cfg.clientSpanStatus(req, resp))
 				attrs = append(attrs, semconv.HTTPStatusCodeKey.Int(resp.StatusCode()))
+				if readBytes = responseBodySize(resp); readBytes > 0 {
+					attrs = append(attrs, ReadBytesKey.Int(readBytes))
+				}
 			} else { // resp.StatusCode() is not valid when client returns error
 				span.SetStatus(codes.Error, err.Error())
+				recordException(span, err, false)
+				// the tracing dialer tells whether the request was fully written
+				if traced {
+					if ct.wroteReq.IsZero() {
+						attrs = append(attrs, WriteErrorKey.String(err.Error()))
+					} else {
+						attrs = append(attrs, ReadErrorKey.String(err.Error()))
+					}
+				}
 			}
 			span.SetAttributes(attrs...)
 
@@ -122,9 +181,15 @@ func ClientMiddleware(opts ...Option) client.Middleware {
 			counters[ClientRequestCount].Add(ctx, 1, metric.WithAttributes(metricsAttributes...))
 			histogramRecorder[ClientLatency].Record(
 				ctx,
-				float64(time.Since(start))/float64(time.Millisecond),
+				float64(end.Sub(start))/float64(time.Millisecond),
 				metric.WithAttributes(metricsAttributes...),
 			)
+			histogramRecorder[ClientRequestSize].Record(ctx, float64(wroteBytes), metric.WithAttributes(metricsAttributes...))
+			histogramRecorder[ClientResponseSize].Record(ctx, float64(readBytes), metric.WithAttributes(metricsAttributes...))
+
+			if traced && cfg.clientPhaseMetrics {
+				recordClientPhaseMetrics(ctx, histogramRecorder, ct, start, end, append(metricsAttributes, ConnReusedKey.Bool(ct.reused)))
+			}
 
 			return
 		}
@@ -132,52 +197,161 @@ func ClientMiddleware(opts ...Option) client.Middleware {
 }
 
 func ServerMiddleware(cfg *Config) app.HandlerFunc {
+	fallback := &fallbackTracer{cfg: cfg}
 	return func(ctx context.Context, c *app.RequestContext) {
-		if cfg.shouldIgnore(ctx, c) {
-			c.Next(ctx)
-			return
-		}
-		// get tracer carrier
-		tc := internal.TraceCarrierFromContext(ctx)
-		if tc == nil {
-			hlog.CtxWarnf(ctx, "TraceCarrier not found in context")
+		// the server span is started by the middleware of the route group
+		if hasGroupMiddleware(c) {
 			c.Next(ctx)
 			return
 		}
+		serve(ctx, c, cfg, fallback)
+	}
+}
 
-		sTracer := tc.Tracer()
-		ti := c.GetTraceInfo()
-		if ti.Stats().Level() == stats.LevelDisabled {
-			c.Next(ctx)
-			return
-		}
+// fallbackTracer finishes the server spans when the server is created without the tracer
+// of NewServerTracer, the measures are created with the first request.
+type fallbackTracer struct {
+	cfg    *Config
+	once   sync.Once
+	tracer *serverTracer
+}
+
+func (f *fallbackTracer) serverTracer() *serverTracer {
+	f.once.Do(func() {
+		f.tracer = newServerTracer(f.cfg)
+	})
+	return f.tracer
+}
+
+// serve calls the next handlers with the server span started by cfg, the span is finished by
+// the middleware if the server runs without the tracer.
+func serve(ctx context.Context, c *app.RequestContext, cfg *Config, fallback *fallbackTracer) {
+	if internal.TraceCarrierFromContext(ctx) != nil {
+		serveWithSpan(ctx, c, cfg)
+		return
+	}
+
+	start := time.Now()
+	st := fallback.serverTracer()
+	ctx = st.Start(ctx, c)
+	serveWithSpan(ctx, c, cfg)
+
+	if tc := internal.TraceCarrierFromContext(ctx); tc.Span() != nil {
+		st.finish(ctx, c, cfg, tc, tc.Span(), nil, start, time.Now())
+	}
+}
 
-		opts := []oteltrace.SpanStartOption{
-			oteltrace.WithTimestamp(getStartTimeOrNow(ti)),
-			oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+// startServerSpan starts the server span of the request with the remote span context and
+// the baggage extracted from the request headers.
+func startServerSpan(ctx context.Context, c *app.RequestContext, cfg *Config, tracer oteltrace.Tracer, start time.Time) (context.Context, oteltrace.Span) {
+	opts := []oteltrace.SpanStartOption{
+		oteltrace.WithTimestamp(start),
+		oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+	}
+
+	var peerServiceAttributes []attribute.KeyValue
+	if cfg.trustPeerService == nil || cfg.trustPeerService(ctx, c) {
+		peerServiceAttributes = extractPeerServiceAttributesFromMetadata(&c.Request.Header, cfg.peerServiceHeaders)
+		if len(peerServiceAttributes) == 0 && cfg.kitexCompatibility {
+			peerServiceAttributes = kitexPeerServiceAttributes(&c.Request.Header)
 		}
+	}
 
-		peerServiceAttributes := extractPeerServiceAttributesFromMetadata(&c.Request.Header)
+	// extract baggage and span context from header
+	bags, spanCtx := Extract(ctx, cfg, &c.Request.Header)
 
-		// extract baggage and span context from header
-		bags, spanCtx := Extract(ctx, cfg, &c.Request.Header)
+	// set baggage
+	ctx = baggage.ContextWithBaggage(ctx, bags)
 
-		// set baggage
-		ctx = baggage.ContextWithBaggage(ctx, bags)
+	ctx = oteltrace.ContextWithRemoteSpanContext(ctx, spanCtx)
+	spanName := cfg.serverSpanNameFormatter(c)
 
-		ctx, span := sTracer.Start(oteltrace.ContextWithRemoteSpanContext(ctx, spanCtx), cfg.serverSpanNameFormatter(c), opts...)
+	parentCtx := ctx
+	ctx, span := tracer.Start(ctx, spanName, opts...)
+	// the sampler of the config decides on the trace id of the span, which is propagated
+	if span.IsRecording() && !cfg.shouldSample(parentCtx, span.SpanContext().TraceID(), spanName) {
+		span = newDroppedSpan(span)
+		ctx = oteltrace.ContextWithSpan(parentCtx, span)
+	}
 
-		// peer service attributes
-		span.SetAttributes(peerServiceAttributes...)
+	// peer service attributes
+	span.SetAttributes(peerServiceAttributes...)
 
-		// set span and attrs into tracer carrier for serverTracer finish
-		tc.SetSpan(span)
+	return ctx, span
+}
 
+// serveWithSpan calls the next handlers with the server span started by cfg.
+func serveWithSpan(ctx context.Context, c *app.RequestContext, cfg *Config) {
+	if cfg.shouldIgnore(ctx, c) {
 		c.Next(ctx)
+		return
+	}
+	// get tracer carrier
+	tc := internal.TraceCarrierFromContext(ctx)
 
-		if cfg.customResponseHandler != nil {
-			// execute custom response handler
-			cfg.customResponseHandler(ctx, c)
-		}
+	sTracer := tc.Tracer()
+	ti := c.GetTraceInfo()
+	if ti != nil && ti.Stats().Level() == stats.LevelDisabled {
+		c.Next(ctx)
+		return
+	}
+
+	if cfg.kitexCompatibility {
+		ctx = metainfoFromRequest(ctx, &c.Request.Header)
+	}
+
+	ctx, span := startServerSpan(ctx, c, cfg, sTracer, getStartTimeOrNow(ti))
+
+	// set span and attrs into tracer carrier for serverTracer finish
+	tc.SetSpan(span)
+	// keep span in request context for SpanFromRequestContext
+	c.Set(serverSpanKey, span)
+
+	traceResponse := cfg.traceResponseHeadersEnabled()
+	if traceResponse && cfg.responseHeaderCondition == nil {
+		cfg.injectTraceResponseHeaders(c, span.SpanContext())
+	}
+
+	if cfg.handlerTracing != HandlerTracingDisabled {
+		defer cfg.handlerChains.traceHandlers(c, cfg.handlerTracing)()
+	}
+
+	if cfg.streamTracing {
+		nextWithStreamRecorder(ctx, c, tc, cfg.streamEventLimit)
+	} else {
+		c.Next(ctx)
+	}
+
+	if traceResponse && cfg.responseHeaderCondition != nil && cfg.responseHeaderCondition(ctx, c) {
+		cfg.injectTraceResponseHeaders(c, span.SpanContext())
+	}
+
+	if cfg.customResponseHandler != nil {
+		// execute custom response handler
+		cfg.customResponseHandler(ctx, c)
+	}
+}
+
+// nextWithStreamRecorder calls the next handlers with the connection wrapped, so the chunks
+// flushed while handling the request and the data exchanged by a hijack handler are recorded.
+func nextWithStreamRecorder(ctx context.Context, c *app.RequestContext, tc *internal.TraceCarrier, maxEvents int) {
+	conn := c.GetConn()
+	if conn == nil {
+		c.Next(ctx)
+		return
+	}
+
+	recorder := newStreamRecorder(tc.Span(), maxEvents)
+	tc.SetStream(recorder)
+
+	c.SetConn(&streamConn{Conn: conn, recorder: recorder})
+	c.Next(ctx)
+	c.SetConn(conn)
+
+	if hijackHandler := c.GetHijackHandler(); hijackHandler != nil {
+		recorder.setHijacked()
+		c.SetHijackHandler(func(conn network.Conn) {
+			hijackHandler(&streamConn{Conn: conn, recorder: recorder})
+		})
 	}
 }
@@ -16,7 +16,10 @@ package tracing
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
@@ -24,14 +27,26 @@ import (
 	"time"
 
 	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/client"
+	"github.com/cloudwego/hertz/pkg/app/middlewares/server/recovery"
 	"github.com/cloudwego/hertz/pkg/app/server"
 	"github.com/cloudwego/hertz/pkg/common/test/assert"
 	"github.com/cloudwego/hertz/pkg/common/tracer/stats"
+	"github.com/cloudwego/hertz/pkg/network"
+	"github.com/cloudwego/hertz/pkg/network/standard"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/cloudwego/hertz/pkg/protocol/http1/resp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
 	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
@@ -193,3 +208,1005 @@ func TestServerTracerNoDataRace(t *testing.T) {
 	// Shutdown triggers final export, which may also race with any pending operations
 	_ = tp.Shutdown(context.Background())
 }
+
+func TestClientMiddlewareConnTrace(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	h := server.Default(server.WithHostPorts("127.0.0.1:26667"))
+	h.GET("/ping", func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "pong")
+	})
+	go h.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	c, _ := client.NewClient(client.WithDialer(NewDialer(standard.NewDialer())))
+	c.Use(ClientMiddleware(WithClientPhaseMetrics(true)))
+
+	for i := 0; i < 2; i++ {
+		req, resp := protocol.AcquireRequest(), protocol.AcquireResponse()
+		req.SetRequestURI("http://localhost:26667/ping")
+		assert.Nil(t, c.Do(context.Background(), req, resp))
+		// the remote address of the response is the one of the connection
+		_, ok := resp.RemoteAddr().(*net.TCPAddr)
+		assert.True(t, ok)
+		protocol.ReleaseRequest(req)
+		protocol.ReleaseResponse(resp)
+	}
+
+	spans := sr.Ended()
+	assert.DeepEqual(t, 2, len(spans))
+
+	eventNames := func(span sdktrace.ReadOnlySpan) map[string]bool {
+		names := make(map[string]bool)
+		for _, e := range span.Events() {
+			names[e.Name] = true
+		}
+		return names
+	}
+
+	first, second := eventNames(spans[0]), eventNames(spans[1])
+	for _, name := range []string{"dns_start", "dns_done", "connect_start", "connect_done", "got_conn", "wrote_request", "got_first_response_byte"} {
+		assert.True(t, first[name])
+	}
+	assert.False(t, second["connect_start"])
+	assert.True(t, second["got_first_response_byte"])
+	assert.True(t, hasAttribute(spans[0].Attributes(), ConnReusedKey.Bool(false)))
+	assert.True(t, hasAttribute(spans[1].Attributes(), ConnReusedKey.Bool(true)))
+
+	var rm metricdata.ResourceMetrics
+	assert.Nil(t, reader.Collect(context.Background(), &rm))
+	recorded := make(map[string]bool)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			recorded[m.Name] = true
+		}
+	}
+	for _, name := range []string{ClientDNSLatency, ClientConnectLatency, ClientConnAcquireLatency, ClientFirstByteLatency, ClientBodyReadLatency} {
+		assert.True(t, recorded[name])
+	}
+}
+
+func TestClientMiddlewareConnTraceSaturatedPool(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider())
+
+	h := server.Default(server.WithHostPorts("127.0.0.1:26686"))
+	h.GET("/slow", func(c context.Context, ctx *app.RequestContext) {
+		time.Sleep(100 * time.Millisecond)
+		ctx.String(200, "pong")
+	})
+	go h.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	// the second request waits for the connection of the first one
+	c, _ := client.NewClient(
+		client.WithDialer(NewDialer(standard.NewDialer())),
+		client.WithMaxConnsPerHost(1),
+		client.WithMaxConnWaitTimeout(time.Second),
+	)
+	c.Use(ClientMiddleware())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := c.Get(context.Background(), nil, "http://127.0.0.1:26686/slow")
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	spans := sr.Ended()
+	assert.DeepEqual(t, 2, len(spans))
+
+	var dialed, reused int
+	for _, span := range spans {
+		events := make(map[string]time.Time)
+		for _, e := range span.Events() {
+			events[e.Name] = e.Time
+		}
+		if hasAttribute(span.Attributes(), ConnReusedKey.Bool(true)) {
+			reused++
+			_, connected := events["connect_start"]
+			assert.False(t, connected)
+			// the connection is acquired once the first request is finished
+			assert.True(t, events["got_conn"].Sub(span.StartTime()) >= 50*time.Millisecond)
+		} else {
+			dialed++
+			_, connected := events["connect_start"]
+			assert.True(t, connected)
+		}
+		assert.True(t, events["got_first_response_byte"].After(events["got_conn"]))
+	}
+	assert.DeepEqual(t, 1, dialed)
+	assert.DeepEqual(t, 1, reused)
+}
+
+// addressDialer records the addresses it dials.
+type addressDialer struct {
+	network.Dialer
+	addresses []string
+}
+
+func (d *addressDialer) DialConnection(n, address string, timeout time.Duration, tlsConfig *tls.Config) (network.Conn, error) {
+	d.addresses = append(d.addresses, address)
+	return d.Dialer.DialConnection(n, address, timeout, tlsConfig)
+}
+
+func TestDialerResolution(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	address := net.JoinHostPort("localhost", port)
+
+	// the address is passed as is to the dialers which are not known to use the default resolver
+	custom := &addressDialer{Dialer: standard.NewDialer()}
+	conn, err := NewDialer(custom).DialConnection("tcp", address, time.Second, nil)
+	assert.Nil(t, err)
+	_ = conn.Close()
+	assert.DeepEqual(t, []string{address}, custom.addresses)
+	assert.True(t, conn.(*tracedConn).dial.dnsStart.IsZero())
+
+	conn, err = NewDialer(standard.NewDialer()).DialConnection("tcp", address, time.Second, nil)
+	assert.Nil(t, err)
+	_ = conn.Close()
+	assert.False(t, conn.(*tracedConn).dial.dnsStart.IsZero())
+}
+
+func hasAttribute(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, attr := range attrs {
+		if attr == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestServerTimingMetrics(t *testing.T) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	tracer, cfg := NewServerTracer(WithServerTimingMetrics(true))
+	h := server.Default(tracer,
+		server.WithHostPorts("127.0.0.1:26668"),
+		server.WithTraceLevel(stats.LevelDetailed),
+	)
+	h.Use(ServerMiddleware(cfg))
+	h.POST("/upload", func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "ok")
+	})
+
+	go h.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err := http.Post("http://127.0.0.1:26668/upload", "text/plain", strings.NewReader("payload"))
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	var rm metricdata.ResourceMetrics
+	assert.Nil(t, reader.Collect(context.Background(), &rm))
+	recorded := make(map[string]bool)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			recorded[m.Name] = true
+		}
+	}
+	for _, name := range []string{ServerReadHeaderLatency, ServerReadBodyLatency, ServerHandleLatency, ServerWriteLatency} {
+		assert.True(t, recorded[name])
+	}
+}
+
+func TestBodySizeAttributes(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider())
+
+	tracer, cfg := NewServerTracer()
+	h := server.Default(tracer, server.WithHostPorts("127.0.0.1:26669"))
+	h.Use(ServerMiddleware(cfg))
+	h.POST("/echo", func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "ok")
+	})
+	go h.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	c, _ := client.NewClient()
+	c.Use(ClientMiddleware())
+
+	req, resp := protocol.AcquireRequest(), protocol.AcquireResponse()
+	req.SetRequestURI("http://127.0.0.1:26669/echo")
+	req.SetMethod("POST")
+	req.SetBodyString("payload")
+	assert.Nil(t, c.Do(context.Background(), req, resp))
+	time.Sleep(50 * time.Millisecond)
+
+	var serverSpan, clientSpan sdktrace.ReadOnlySpan
+	for _, span := range sr.Ended() {
+		switch span.SpanKind() {
+		case oteltrace.SpanKindServer:
+			serverSpan = span
+		case oteltrace.SpanKindClient:
+			clientSpan = span
+		}
+	}
+	assert.NotNil(t, serverSpan)
+	assert.NotNil(t, clientSpan)
+	assert.True(t, hasAttribute(serverSpan.Attributes(), ReadBytesKey.Int(7)))
+	assert.True(t, hasAttribute(serverSpan.Attributes(), WroteBytesKey.Int(2)))
+	assert.True(t, hasAttribute(clientSpan.Attributes(), WroteBytesKey.Int(7)))
+	assert.True(t, hasAttribute(clientSpan.Attributes(), ReadBytesKey.Int(2)))
+}
+
+func TestServerExceptionEvents(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider())
+
+	tracer, cfg := NewServerTracer(
+		WithErrorClassifier(func(ctx context.Context, c *app.RequestContext, err error) bool {
+			return c.Response.StatusCode() >= 500
+		}),
+		WithErrorAttributes(func(ctx context.Context, c *app.RequestContext, err error) []attribute.KeyValue {
+			return []attribute.KeyValue{attribute.String("app.error_code", "E42")}
+		}),
+	)
+	h := server.New(tracer, server.WithHostPorts("127.0.0.1:26670"))
+	h.Use(ServerMiddleware(cfg), recovery.Recovery(recovery.WithRecoveryHandler(RecoveryHandler(nil))))
+	h.GET("/panic", func(c context.Context, ctx *app.RequestContext) {
+		panic("boom")
+	})
+	h.GET("/invalid", func(c context.Context, ctx *app.RequestContext) {
+		_ = ctx.Error(errors.New("invalid argument"))
+		ctx.String(400, "invalid")
+	})
+	go h.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	for _, path := range []string{"/panic", "/invalid"} {
+		resp, err := http.Get("http://127.0.0.1:26670" + path)
+		assert.Nil(t, err)
+		_ = resp.Body.Close()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	spans := sr.Ended()
+	assert.DeepEqual(t, 2, len(spans))
+
+	exceptionOf := func(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+		for _, e := range span.Events() {
+			if e.Name == semconv.ExceptionEventName {
+				attrs := make(map[attribute.Key]attribute.Value)
+				for _, attr := range e.Attributes {
+					attrs[attr.Key] = attr.Value
+				}
+				return attrs
+			}
+		}
+		return nil
+	}
+
+	panicked := exceptionOf(spans[0])
+	assert.DeepEqual(t, codes.Error, spans[0].Status().Code)
+	assert.DeepEqual(t, "string", panicked[semconv.ExceptionTypeKey].AsString())
+	assert.DeepEqual(t, "boom", panicked[semconv.ExceptionMessageKey].AsString())
+	assert.True(t, panicked[semconv.ExceptionEscapedKey].AsBool())
+	assert.True(t, panicked[semconv.ExceptionStacktraceKey].AsString() != "")
+	assert.DeepEqual(t, "E42", panicked["app.error_code"].AsString())
+
+	invalid := exceptionOf(spans[1])
+	assert.DeepEqual(t, codes.Unset, spans[1].Status().Code)
+	assert.DeepEqual(t, "*errors.errorString", invalid[semconv.ExceptionTypeKey].AsString())
+	assert.False(t, invalid[semconv.ExceptionEscapedKey].AsBool())
+	assert.True(t, hasAttribute(spans[1].Attributes(), attribute.String("app.error_code", "E42")))
+}
+
+func TestServerDefaultErrorClassifier(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider())
+
+	tracer, cfg := NewServerTracer()
+	h := server.New(tracer, server.WithHostPorts("127.0.0.1:26685"))
+	h.Use(ServerMiddleware(cfg))
+	h.GET("/invalid", func(c context.Context, ctx *app.RequestContext) {
+		_ = ctx.Error(errors.New("invalid argument"))
+		ctx.String(400, "invalid")
+	})
+	h.GET("/failed", func(c context.Context, ctx *app.RequestContext) {
+		_ = ctx.Error(errors.New("database unavailable"))
+		ctx.String(500, "failed")
+	})
+	go h.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	for _, path := range []string{"/invalid", "/failed"} {
+		resp, err := http.Get("http://127.0.0.1:26685" + path)
+		assert.Nil(t, err)
+		_ = resp.Body.Close()
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	spans := sr.Ended()
+	assert.DeepEqual(t, 2, len(spans))
+	hasException := func(span sdktrace.ReadOnlySpan) bool {
+		for _, e := range span.Events() {
+			if e.Name == semconv.ExceptionEventName {
+				return true
+			}
+		}
+		return false
+	}
+
+	// the errors of 4xx responses are recorded without marking the span as error
+	assert.DeepEqual(t, codes.Unset, spans[0].Status().Code)
+	assert.True(t, hasException(spans[0]))
+	assert.DeepEqual(t, codes.Error, spans[1].Status().Code)
+	assert.True(t, hasException(spans[1]))
+}
+
+func TestServerStreamTracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	tracer, cfg := NewServerTracer(WithStreamTracing(true), WithStreamEventLimit(3))
+	h := server.Default(tracer, server.WithHostPorts("127.0.0.1:26671"))
+	h.Use(ServerMiddleware(cfg))
+	h.GET("/events", func(c context.Context, ctx *app.RequestContext) {
+		ctx.SetContentType("text/event-stream")
+		ctx.Response.HijackWriter(resp.NewChunkedBodyWriter(&ctx.Response, ctx.GetWriter()))
+		for i := 0; i < 3; i++ {
+			_, _ = ctx.Write([]byte("data: ping\n\n"))
+			_ = ctx.Flush()
+		}
+	})
+	h.GET("/ws", func(c context.Context, ctx *app.RequestContext) {
+		ctx.Hijack(func(conn network.Conn) {
+			_, _ = conn.Write([]byte("hello"))
+		})
+		ctx.SetStatusCode(101)
+		ctx.Response.Header.Set("Upgrade", "websocket")
+		ctx.Response.Header.Set("Connection", "Upgrade")
+	})
+	go h.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err := http.Get("http://127.0.0.1:26671/events")
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.DeepEqual(t, strings.Repeat("data: ping\n\n", 3), string(body))
+
+	conn, err := net.Dial("tcp", "127.0.0.1:26671")
+	assert.Nil(t, err)
+	_, _ = conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: 127.0.0.1\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n"))
+	_, _ = io.ReadAll(conn)
+	_ = conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	spans := sr.Ended()
+	assert.DeepEqual(t, 2, len(spans))
+
+	sse := spans[0]
+	assert.True(t, hasAttribute(sse.Attributes(), StreamKindKey.String(StreamKindSSE)))
+	// the response header is flushed with the first chunk, and the last chunk
+	// is flushed when the writer is finalized
+	assert.True(t, hasAttribute(sse.Attributes(), StreamSentMessagesKey.Int(4)))
+	assert.True(t, hasAttribute(sse.Attributes(), StreamDroppedEventsKey.Int(2)))
+	messages := 0
+	for _, e := range sse.Events() {
+		if e.Name == "message" {
+			messages++
+		}
+	}
+	assert.DeepEqual(t, 2, messages)
+
+	ws := spans[1]
+	assert.True(t, hasAttribute(ws.Attributes(), StreamKindKey.String(StreamKindWebSocket)))
+	assert.True(t, hasAttribute(ws.Attributes(), StreamSentBytesKey.Int(5)))
+
+	var rm metricdata.ResourceMetrics
+	assert.Nil(t, reader.Collect(context.Background(), &rm))
+	var streams uint64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == ServerStreamDuration {
+				for _, dp := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+					streams += dp.Count
+				}
+			}
+		}
+	}
+	assert.DeepEqual(t, uint64(2), streams)
+}
+
+func TestServerStreamWithoutStreamTracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	tracer, cfg := NewServerTracer()
+	h := server.Default(tracer, server.WithHostPorts("127.0.0.1:26684"))
+	h.Use(ServerMiddleware(cfg))
+	h.GET("/events", func(c context.Context, ctx *app.RequestContext) {
+		ctx.SetContentType("text/event-stream")
+		ctx.Response.HijackWriter(resp.NewChunkedBodyWriter(&ctx.Response, ctx.GetWriter()))
+		_, _ = ctx.Write([]byte("data: ping\n\n"))
+		_ = ctx.Flush()
+	})
+	go h.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err := http.Get("http://127.0.0.1:26684/events")
+	assert.Nil(t, err)
+	_, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	// streams are recorded as regular requests unless WithStreamTracing is enabled
+	spans := sr.Ended()
+	assert.DeepEqual(t, 1, len(spans))
+	for _, kv := range spans[0].Attributes() {
+		assert.True(t, kv.Key != StreamKindKey)
+	}
+
+	var rm metricdata.ResourceMetrics
+	assert.Nil(t, reader.Collect(context.Background(), &rm))
+	var latencies, streams uint64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch m.Name {
+			case ServerLatency:
+				for _, dp := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+					latencies += dp.Count
+				}
+			case ServerStreamDuration:
+				for _, dp := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+					streams += dp.Count
+				}
+			}
+		}
+	}
+	assert.DeepEqual(t, uint64(1), latencies)
+	assert.DeepEqual(t, uint64(0), streams)
+}
+
+func handlerTracingAuth(c context.Context, ctx *app.RequestContext) {
+	ctx.Response.Header.Set("auth-handler-name", ctx.HandlerName())
+	ctx.Next(c)
+}
+
+func handlerTracingPing(c context.Context, ctx *app.RequestContext) {
+	ctx.Response.Header.Set("handler-name", ctx.HandlerName())
+	ctx.String(200, "pong")
+}
+
+func TestServerHandlerTracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider())
+
+	spansTracer, spansCfg := NewServerTracer(WithHandlerTracing(HandlerTracingSpans))
+	h := server.New(spansTracer, server.WithHostPorts("127.0.0.1:26672"))
+	h.Use(ServerMiddleware(spansCfg), handlerTracingAuth)
+	h.GET("/ping", handlerTracingPing)
+	go h.Spin()
+
+	eventsTracer, eventsCfg := NewServerTracer(WithHandlerTracing(HandlerTracingEvents))
+	h2 := server.New(eventsTracer, server.WithHostPorts("127.0.0.1:26673"))
+	h2.Use(ServerMiddleware(eventsCfg), handlerTracingAuth)
+	h2.GET("/ping", handlerTracingPing)
+	go h2.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	for _, addr := range []string{"127.0.0.1:26672", "127.0.0.1:26673"} {
+		for i := 0; i < 2; i++ {
+			resp, err := http.Get("http://" + addr + "/ping")
+			assert.Nil(t, err)
+			_ = resp.Body.Close()
+			// the handlers see the name of the main handler
+			assert.True(t, strings.HasSuffix(resp.Header.Get("handler-name"), "handlerTracingPing"))
+			assert.True(t, strings.HasSuffix(resp.Header.Get("auth-handler-name"), "handlerTracingPing"))
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// the second request of each server reuses the traced handlers
+	spans := sr.Ended()
+	assert.DeepEqual(t, 8, len(spans))
+	spans = append(spans[:3:3], spans[6])
+
+	// child spans end before their parents
+	ping, auth, serverSpan := spans[0], spans[1], spans[2]
+	assert.True(t, strings.HasSuffix(ping.Name(), "handlerTracingPing"))
+	assert.True(t, strings.HasSuffix(auth.Name(), "handlerTracingAuth"))
+	assert.DeepEqual(t, "GET /ping", serverSpan.Name())
+	assert.DeepEqual(t, oteltrace.SpanKindInternal, ping.SpanKind())
+	assert.DeepEqual(t, auth.SpanContext().SpanID(), ping.Parent().SpanID())
+	assert.DeepEqual(t, serverSpan.SpanContext().SpanID(), auth.Parent().SpanID())
+	assert.True(t, hasAttribute(ping.Attributes(), HandlerNameKey.String(ping.Name())))
+
+	var handlers []string
+	for _, e := range spans[3].Events() {
+		if e.Name != "handler" {
+			continue
+		}
+		for _, attr := range e.Attributes {
+			if attr.Key == HandlerNameKey {
+				handlers = append(handlers, attr.Value.AsString())
+			}
+		}
+	}
+	assert.DeepEqual(t, 2, len(handlers))
+	assert.True(t, strings.HasSuffix(handlers[0], "handlerTracingPing"))
+	assert.True(t, strings.HasSuffix(handlers[1], "handlerTracingAuth"))
+}
+
+func BenchmarkTraceHandlers(b *testing.B) {
+	cfg := newConfig([]Option{WithHandlerTracing(HandlerTracingSpans)})
+	handlers := app.HandlersChain{ServerMiddleware(cfg), handlerTracingAuth, handlerTracingPing}
+	ctx := context.Background()
+	c := app.NewContext(0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.SetHandlers(handlers)
+		c.SetIndex(0)
+		restore := cfg.handlerChains.traceHandlers(c, cfg.handlerTracing)
+		c.Next(ctx)
+		restore()
+	}
+}
+
+func TestServerSpanHelpers(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider())
+
+	tracer, cfg := NewServerTracer()
+	h := server.New(tracer, server.WithHostPorts("127.0.0.1:26674"))
+	h.Use(ServerMiddleware(cfg))
+	h.GET("/ping", func(c context.Context, ctx *app.RequestContext) {
+		SetSpanAttributes(ctx, attribute.String("app.user", "alice"))
+		AddSpanEvent(ctx, "cache_miss")
+
+		_, span := StartSpan(c, "load_user")
+		span.End()
+
+		ctx.String(200, "pong")
+	})
+	go h.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err := http.Get("http://127.0.0.1:26674/ping")
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	spans := sr.Ended()
+	assert.DeepEqual(t, 2, len(spans))
+
+	child, serverSpan := spans[0], spans[1]
+	assert.DeepEqual(t, "load_user", child.Name())
+	assert.DeepEqual(t, oteltrace.SpanKindInternal, child.SpanKind())
+	assert.DeepEqual(t, instrumentationName, child.InstrumentationScope().Name)
+	assert.DeepEqual(t, serverSpan.SpanContext().SpanID(), child.Parent().SpanID())
+
+	assert.True(t, hasAttribute(serverSpan.Attributes(), attribute.String("app.user", "alice")))
+	events := 0
+	for _, e := range serverSpan.Events() {
+		if e.Name == "cache_miss" {
+			events++
+		}
+	}
+	assert.DeepEqual(t, 1, events)
+
+	// requests without ServerMiddleware get a non-recording span
+	assert.False(t, SpanFromRequestContext(app.NewContext(0)).IsRecording())
+}
+
+func TestServerTraceResponseHeaders(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider())
+
+	tracer, cfg := NewServerTracer(WithTraceIDResponseHeader("X-Trace-Id"), WithTraceResponse(true))
+	h := server.New(tracer, server.WithHostPorts("127.0.0.1:26675"))
+	h.Use(ServerMiddleware(cfg))
+	h.GET("/ping", func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "pong")
+	})
+	go h.Spin()
+
+	errTracer, errCfg := NewServerTracer(
+		WithTraceIDResponseHeader("X-Trace-Id"),
+		WithTraceResponseCondition(func(ctx context.Context, c *app.RequestContext) bool {
+			return c.Response.StatusCode() >= 500
+		}),
+	)
+	h2 := server.New(errTracer, server.WithHostPorts("127.0.0.1:26676"))
+	h2.Use(ServerMiddleware(errCfg))
+	h2.GET("/ping", func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "pong")
+	})
+	h2.GET("/error", func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(500, "error")
+	})
+	go h2.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	get := func(url string) http.Header {
+		resp, err := http.Get(url)
+		assert.Nil(t, err)
+		_ = resp.Body.Close()
+		return resp.Header
+	}
+
+	header := get("http://127.0.0.1:26675/ping")
+	time.Sleep(50 * time.Millisecond)
+	spans := sr.Ended()
+	assert.DeepEqual(t, 1, len(spans))
+	sc := spans[0].SpanContext()
+	assert.DeepEqual(t, sc.TraceID().String(), header.Get("X-Trace-Id"))
+	assert.DeepEqual(t, "00-"+sc.TraceID().String()+"-"+sc.SpanID().String()+"-01", header.Get(TraceResponseHeader))
+
+	header = get("http://127.0.0.1:26676/ping")
+	assert.DeepEqual(t, "", header.Get("X-Trace-Id"))
+	header = get("http://127.0.0.1:26676/error")
+	assert.True(t, header.Get("X-Trace-Id") != "")
+	assert.DeepEqual(t, "", header.Get(TraceResponseHeader))
+}
+
+// exemplarMeterProvider captures the contexts of histogram recordings.
+type exemplarMeterProvider struct {
+	noop.MeterProvider
+	mu   sync.Mutex
+	ctxs map[string][]context.Context
+}
+
+func (p *exemplarMeterProvider) Meter(string, ...metric.MeterOption) metric.Meter {
+	return exemplarMeter{provider: p}
+}
+
+type exemplarMeter struct {
+	noop.Meter
+	provider *exemplarMeterProvider
+}
+
+func (m exemplarMeter) Float64Histogram(name string, _ ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	return exemplarHistogram{name: name, provider: m.provider}, nil
+}
+
+type exemplarHistogram struct {
+	noop.Float64Histogram
+	name     string
+	provider *exemplarMeterProvider
+}
+
+func (h exemplarHistogram) Record(ctx context.Context, _ float64, _ ...metric.RecordOption) {
+	h.provider.mu.Lock()
+	h.provider.ctxs[h.name] = append(h.provider.ctxs[h.name], ctx)
+	h.provider.mu.Unlock()
+}
+
+func TestServerMetricsWithSpanContext(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	mp := &exemplarMeterProvider{ctxs: make(map[string][]context.Context)}
+	otel.SetMeterProvider(mp)
+
+	tracer, cfg := NewServerTracer()
+	h := server.New(tracer, server.WithHostPorts("127.0.0.1:26677"))
+	h.Use(ServerMiddleware(cfg))
+	h.GET("/ping", func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "pong")
+	})
+	go h.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err := http.Get("http://127.0.0.1:26677/ping")
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	spans := sr.Ended()
+	assert.DeepEqual(t, 1, len(spans))
+
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	assert.DeepEqual(t, 1, len(mp.ctxs[ServerLatency]))
+	assert.DeepEqual(t, spans[0].SpanContext(), oteltrace.SpanContextFromContext(mp.ctxs[ServerLatency][0]))
+}
+
+// dropSampler drops all spans and records the trace ids it samples.
+type dropSampler struct {
+	traceIDs []oteltrace.TraceID
+}
+
+func (s *dropSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	s.traceIDs = append(s.traceIDs, p.TraceID)
+	return sdktrace.SamplingResult{Decision: sdktrace.Drop}
+}
+
+func (s *dropSampler) Description() string {
+	return "drop"
+}
+
+func TestServerSamplerTraceID(t *testing.T) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	sampler := &dropSampler{}
+	cfg := newConfig([]Option{WithSampler(sampler)})
+	c := app.NewContext(0)
+	c.Request.SetRequestURI("/ping")
+
+	// the dropped root span propagates the trace id the sampler decided on
+	ctx, span := startServerSpan(context.Background(), c, cfg, cfg.tracer, time.Now())
+	assert.DeepEqual(t, 1, len(sampler.traceIDs))
+	assert.True(t, sampler.traceIDs[0].IsValid())
+	assert.DeepEqual(t, sampler.traceIDs[0], span.SpanContext().TraceID())
+	assert.False(t, span.SpanContext().IsSampled())
+	assert.DeepEqual(t, span.SpanContext(), oteltrace.SpanContextFromContext(ctx))
+}
+
+func TestServerSamplerMetrics(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	tracer, cfg := NewServerTracer(WithSampler(&dropSampler{}))
+	h := server.New(tracer, server.WithHostPorts("127.0.0.1:26687"))
+	h.Use(ServerMiddleware(cfg))
+	h.GET("/ping", func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "pong")
+	})
+	go h.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err := http.Get("http://127.0.0.1:26687/ping")
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	// the dropped requests are not exported, but are recorded in the metrics
+	assert.DeepEqual(t, 0, len(sr.Ended()))
+
+	var rm metricdata.ResourceMetrics
+	assert.Nil(t, reader.Collect(context.Background(), &rm))
+	var requests int64
+	var latencies uint64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch m.Name {
+			case ServerRequestCount:
+				for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					requests += dp.Value
+					assert.True(t, dp.Attributes.HasValue(semconv.HTTPRouteKey))
+				}
+			case ServerLatency:
+				for _, dp := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+					latencies += dp.Count
+				}
+			}
+		}
+	}
+	assert.DeepEqual(t, int64(1), requests)
+	assert.DeepEqual(t, uint64(1), latencies)
+}
+
+func TestServerGroupMiddleware(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider())
+
+	tracer, cfg := NewServerTracer(WithTraceIDResponseHeader("X-Trace-Id"))
+	h := server.New(tracer, server.WithHostPorts("127.0.0.1:26678"))
+	h.Use(ServerMiddleware(cfg))
+
+	pong := func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "pong")
+	}
+	h.GET("/ping", pong)
+
+	admin := h.Group("/admin", GroupMiddleware(cfg,
+		WithServerSpanNameFormatter(func(c *app.RequestContext) string {
+			return "admin " + string(c.Method())
+		}),
+		WithRequestHeaderAttributes("X-Tenant"),
+	))
+	admin.GET("/users", pong)
+	// the innermost group wins
+	admin.Group("/internal", GroupMiddleware(cfg, WithShouldIgnore(func(ctx context.Context, c *app.RequestContext) bool {
+		return true
+	}))).GET("/health", pong)
+
+	h.Group("/batch", GroupMiddleware(cfg, WithSampler(sdktrace.NeverSample()))).GET("/jobs", pong)
+
+	go h.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	get := func(path string) http.Header {
+		req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1:26678"+path, nil)
+		assert.Nil(t, err)
+		req.Header.Set("X-Tenant", "acme")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		_ = resp.Body.Close()
+		time.Sleep(50 * time.Millisecond)
+		return resp.Header
+	}
+
+	get("/ping")
+	get("/admin/users")
+	get("/admin/internal/health")
+	header := get("/batch/jobs")
+	// the trace of the dropped span is still propagated
+	assert.DeepEqual(t, 32, len(header.Get("X-Trace-Id")))
+
+	spans := sr.Ended()
+	assert.DeepEqual(t, 2, len(spans))
+	assert.DeepEqual(t, "GET /ping", spans[0].Name())
+	assert.False(t, hasAttribute(spans[0].Attributes(), attribute.StringSlice("http.request.header.x_tenant", []string{"acme"})))
+	assert.DeepEqual(t, "admin GET", spans[1].Name())
+	assert.True(t, hasAttribute(spans[1].Attributes(), attribute.StringSlice("http.request.header.x_tenant", []string{"acme"})))
+}
+
+func TestServerTracerWithoutMiddleware(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider())
+
+	tracer, _ := NewServerTracer()
+	h := server.New(tracer, server.WithHostPorts("127.0.0.1:26679"))
+	h.GET("/ping", func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "pong")
+	})
+	go h.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get("http://127.0.0.1:26679/ping")
+		assert.Nil(t, err)
+		_ = resp.Body.Close()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	spans := sr.Ended()
+	assert.DeepEqual(t, 2, len(spans))
+	assert.DeepEqual(t, "GET /ping", spans[0].Name())
+	assert.DeepEqual(t, oteltrace.SpanKindServer, spans[0].SpanKind())
+	assert.True(t, hasAttribute(spans[0].Attributes(), semconv.HTTPStatusCodeKey.Int(200)))
+}
+
+func TestInstrument(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	// without the tracer of NewServerTracer
+	h := server.Default(server.WithHostPorts("127.0.0.1:26680"))
+	Instrument(h)
+	h.GET("/ping", func(c context.Context, ctx *app.RequestContext) {
+		_, span := StartSpan(c, "load_user")
+		span.End()
+		ctx.String(200, "pong")
+	})
+
+	// with the tracer, the config of the tracer is used
+	tracer, cfg := NewServerTracer(WithServerSpanNameFormatter(func(c *app.RequestContext) string {
+		return "instrumented"
+	}))
+	h2 := server.New(tracer, server.WithHostPorts("127.0.0.1:26681"))
+	assert.True(t, cfg == Instrument(h2, WithServerTimingMetrics(true)))
+	h2.GET("/ping", func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "pong")
+	})
+
+	go h.Spin()
+	go h2.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	for _, addr := range []string{"127.0.0.1:26680", "127.0.0.1:26681"} {
+		resp, err := http.Get("http://" + addr + "/ping")
+		assert.Nil(t, err)
+		_ = resp.Body.Close()
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// the requests without a route are traced as well
+	resp, err := http.Get("http://127.0.0.1:26680/missing")
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.DeepEqual(t, http.StatusNotFound, resp.StatusCode)
+	time.Sleep(50 * time.Millisecond)
+
+	spans := sr.Ended()
+	assert.DeepEqual(t, 4, len(spans))
+	child, serverSpan := spans[0], spans[1]
+	assert.DeepEqual(t, "load_user", child.Name())
+	assert.DeepEqual(t, "GET /ping", serverSpan.Name())
+	assert.DeepEqual(t, serverSpan.SpanContext().SpanID(), child.Parent().SpanID())
+	assert.True(t, hasAttribute(serverSpan.Attributes(), semconv.HTTPStatusCodeKey.Int(200)))
+	assert.DeepEqual(t, "instrumented", spans[2].Name())
+	assert.True(t, hasAttribute(spans[3].Attributes(), semconv.HTTPStatusCodeKey.Int(404)))
+
+	var rm metricdata.ResourceMetrics
+	assert.Nil(t, reader.Collect(context.Background(), &rm))
+	var requests int64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == ServerRequestCount {
+				for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					requests += dp.Value
+				}
+			}
+		}
+	}
+	assert.DeepEqual(t, int64(3), requests)
+}
+
+func TestServerConnectionMetrics(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	tracer, cfg := NewServerTracer(WithConnectionMetrics(true))
+	h := server.New(tracer, server.WithHostPorts("127.0.0.1:26682"))
+	h.Use(ServerMiddleware(cfg))
+	h.GET("/ping", func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "pong")
+	})
+	go h.Spin()
+	time.Sleep(100 * time.Millisecond)
+
+	transport := &http.Transport{}
+	httpClient := &http.Client{Transport: transport}
+	for i := 0; i < 2; i++ {
+		resp, err := httpClient.Get("http://127.0.0.1:26682/ping")
+		assert.Nil(t, err)
+		_, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+	}
+	transport.CloseIdleConnections()
+	time.Sleep(100 * time.Millisecond)
+
+	spans := sr.Ended()
+	assert.DeepEqual(t, 2, len(spans))
+	assert.True(t, hasAttribute(spans[0].Attributes(), ConnRequestsKey.Int64(1)))
+	assert.True(t, hasAttribute(spans[0].Attributes(), ConnReusedKey.Bool(false)))
+	assert.True(t, hasAttribute(spans[1].Attributes(), ConnRequestsKey.Int64(2)))
+	assert.True(t, hasAttribute(spans[1].Attributes(), ConnReusedKey.Bool(true)))
+	idle, ok := attributeValue(spans[1].Attributes(), ConnIdleDurationKey)
+	assert.True(t, ok)
+	assert.True(t, idle.AsFloat64() >= 0)
+
+	var rm metricdata.ResourceMetrics
+	assert.Nil(t, reader.Collect(context.Background(), &rm))
+	metrics := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	open := metrics[ServerConnectionOpen].(metricdata.Sum[int64])
+	assert.DeepEqual(t, int64(0), open.DataPoints[0].Value)
+	requests := metrics[ServerConnectionRequests].(metricdata.Histogram[int64])
+	assert.DeepEqual(t, uint64(1), requests.DataPoints[0].Count)
+	assert.DeepEqual(t, int64(2), requests.DataPoints[0].Sum)
+	duration := metrics[ServerConnectionDuration].(metricdata.Histogram[float64])
+	assert.DeepEqual(t, uint64(1), duration.DataPoints[0].Count)
+}
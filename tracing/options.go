@@ -20,13 +20,17 @@ import (
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/protocol"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	instrumentationName = "github.com/hertz-contrib/obs-opentelemetry"
+
+	defaultStreamEventLimit = 128
 )
 
 // Option opts for opentelemetry tracer provider
@@ -40,9 +44,24 @@ func (fn option) apply(cfg *Config) {
 	fn(cfg)
 }
 
+// capturedHeader is a header recorded as a span attribute.
+type capturedHeader struct {
+	name string
+	key  attribute.Key
+}
+
 type ConditionFunc func(ctx context.Context, c *app.RequestContext) bool
 
+// ErrorClassifierFunc reports whether err should mark the server span status as error
+type ErrorClassifierFunc func(ctx context.Context, c *app.RequestContext, err error) bool
+
+// ErrorAttributesFunc returns extra attributes for err, eg: domain error codes
+type ErrorAttributesFunc func(ctx context.Context, c *app.RequestContext, err error) []attribute.KeyValue
+
 type Config struct {
+	// opts are the options the config is created with, the base of the route group configs
+	opts []Option
+
 	tracer trace.Tracer
 	meter  metric.Meter
 
@@ -52,23 +71,65 @@ type Config struct {
 	clientSpanNameFormatter func(req *protocol.Request) string
 	serverSpanNameFormatter func(c *app.RequestContext) string
 
+	unmatchedRoutePolicy RoutePolicy
+	staticRoutePolicy    RoutePolicy
+
 	tracerProvider    trace.TracerProvider
 	meterProvider     metric.MeterProvider
 	textMapPropagator propagation.TextMapPropagator
 
 	recordSourceOperation bool
 
+	clientPhaseMetrics  bool
+	serverTimingMetrics bool
+	connectionMetrics   bool
+
+	streamTracing    bool
+	streamEventLimit int
+
+	sampler sdktrace.Sampler
+
+	requestHeaders  []capturedHeader
+	responseHeaders []capturedHeader
+
+	handlerTracing HandlerTracingMode
+	handlerChains  *handlerChainCache
+
+	disablePeerServicePropagation bool
+	peerServiceHosts              []string
+	peerServiceHeaders            PeerServiceHeaders
+	peerServiceHeaderPrefix       string
+	trustPeerService              ConditionFunc
+	clientPeerServiceFunc         PeerServiceFunc
+	clientPeerServiceRules        []peerServiceRule
+
+	kitexCompatibility bool
+
+	traceIDResponseHeader   string
+	traceResponse           bool
+	responseHeaderCondition ConditionFunc
+
 	customResponseHandler app.HandlerFunc
 	shouldIgnore          ConditionFunc
+
+	errorClassifier ErrorClassifierFunc
+	errorAttributes ErrorAttributesFunc
+
+	serverStatusMapper  ServerStatusMapperFunc
+	clientStatusMapper  ClientStatusMapperFunc
+	nonErrorStatusCodes map[int]struct{}
 }
 
 func newConfig(opts []Option) *Config {
 	cfg := defaultConfig()
+	cfg.opts = opts
 
 	for _, opt := range opts {
 		opt.apply(cfg)
 	}
 
+	cfg.peerServiceHeaders = cfg.peerServiceHeaders.withDefaults().withPrefix(cfg.peerServiceHeaderPrefix)
+
 	cfg.meter = cfg.meterProvider.Meter(
 		instrumentationName,
 		metric.WithInstrumentationVersion(SemVersion()),
@@ -83,7 +144,7 @@ func newConfig(opts []Option) *Config {
 }
 
 func defaultConfig() *Config {
-	return &Config{
+	cfg := &Config{
 		tracerProvider:        otel.GetTracerProvider(),
 		meterProvider:         otel.GetMeterProvider(),
 		textMapPropagator:     otel.GetTextMapPropagator(),
@@ -94,31 +155,170 @@ func defaultConfig() *Config {
 		clientSpanNameFormatter: func(req *protocol.Request) string {
 			return string(req.Method()) + " " + string(req.Path())
 		},
-		serverHttpRouteFormatter: func(c *app.RequestContext) string {
-			// FullPath returns a matched route full path. For not found routes
-			// returns an empty string.
-			route := c.FullPath()
-			// fall back to path
-			if route == "" {
-				route = string(c.Path())
-			}
-			return route
-		},
-		serverSpanNameFormatter: func(c *app.RequestContext) string {
-			// Ref to https://github.com/open-telemetry/opentelemetry-specification/blob/ffddc289462dfe0c2041e3ca42a7b1df805706de/specification/trace/api.md#span
-			// FullPath returns a matched route full path. For not found routes
-			// returns an empty string.
-			route := c.FullPath()
-			// fall back to handler name
-			if route == "" {
-				route = string(c.Path())
-			}
-			return string(c.Method()) + " " + route
-		},
 		shouldIgnore: func(ctx context.Context, c *app.RequestContext) bool {
 			return false
 		},
+		serverStatusMapper: DefaultServerStatusMapper,
+		clientStatusMapper: DefaultClientStatusMapper,
+		streamEventLimit:   defaultStreamEventLimit,
+		peerServiceHeaders: defaultPeerServiceHeaders(),
+		handlerChains:      newHandlerChainCache(),
 	}
+	// the default server formatters apply the route policies
+	cfg.serverHttpRouteFormatter = cfg.serverRoute
+	cfg.serverSpanNameFormatter = cfg.serverSpanName
+	return cfg
+}
+
+// WithUnmatchedRoutePolicy configures the route of requests which match no route,
+// eg: RoutePolicyPlaceholder records NOT_FOUND instead of the raw path of scanning traffic
+func WithUnmatchedRoutePolicy(policy RoutePolicy) Option {
+	return option(func(cfg *Config) {
+		cfg.unmatchedRoutePolicy = policy
+	})
+}
+
+// WithStaticRoutePolicy configures the route of requests served by Static and StaticFS
+func WithStaticRoutePolicy(policy RoutePolicy) Option {
+	return option(func(cfg *Config) {
+		cfg.staticRoutePolicy = policy
+	})
+}
+
+// WithHandlerTracing configures tracing every handler after ServerMiddleware, eg: auth,
+// rate limit and the final handler, as child spans or span events. The handlers are
+// wrapped while the chain runs, so c.Handler and c.HandlerName return the wrapper inside handlers
+func WithHandlerTracing(mode HandlerTracingMode) Option {
+	return option(func(cfg *Config) {
+		cfg.handlerTracing = mode
+	})
+}
+
+// WithPeerServicePropagation configures whether the client propagates its service
+// (name, namespace and deployment environment) in the request headers, enabled by default
+func WithPeerServicePropagation(enable bool) Option {
+	return option(func(cfg *Config) {
+		cfg.disablePeerServicePropagation = !enable
+	})
+}
+
+// WithPeerServiceHosts restricts the propagation of the client service to the destination hosts,
+// eg: "user.svc.cluster.local" or "*.svc.cluster.local" for the subdomains
+func WithPeerServiceHosts(hosts ...string) Option {
+	return option(func(cfg *Config) {
+		cfg.peerServiceHosts = hosts
+	})
+}
+
+// WithPeerServiceHeaders configures the header names of the peer service propagation,
+// the empty names are the default ones
+func WithPeerServiceHeaders(headers PeerServiceHeaders) Option {
+	return option(func(cfg *Config) {
+		cfg.peerServiceHeaders = headers
+	})
+}
+
+// WithPeerServiceHeaderPrefix configures the prefix of the peer service header names, eg: x-
+func WithPeerServiceHeaderPrefix(prefix string) Option {
+	return option(func(cfg *Config) {
+		cfg.peerServiceHeaderPrefix = prefix
+	})
+}
+
+// WithTrustedPeerService configures the condition of trusting the peer service headers on the server,
+// eg: PeerIPIn("10.0.0.0/8"). The headers of untrusted requests do not set peer.service
+func WithTrustedPeerService(condition ConditionFunc) Option {
+	return option(func(cfg *Config) {
+		cfg.trustPeerService = condition
+	})
+}
+
+// WithClientPeerServices maps the destinations of the client to peer.service of client spans
+// and metrics, the keys are host patterns with an optional path prefix, eg:
+// "api.stripe.com", "*.s3.amazonaws.com" or "api.example.com/v2/billing", which matches the path
+// /v2/billing and the paths under it.
+// The host of requests sent with the service discovery middleware is the service name.
+// The most specific (longest) matching pattern wins
+func WithClientPeerServices(services map[string]string) Option {
+	return option(func(cfg *Config) {
+		cfg.clientPeerServiceRules = newPeerServiceRules(services)
+	})
+}
+
+// WithClientPeerServiceFunc configures the func returning peer.service of client spans,
+// the mapping of WithClientPeerServices is used when it returns an empty name
+func WithClientPeerServiceFunc(fn PeerServiceFunc) Option {
+	return option(func(cfg *Config) {
+		cfg.clientPeerServiceFunc = fn
+	})
+}
+
+// WithSampler configures the sampler of the server spans which is applied before the sampler
+// of the tracer provider, eg: sdktrace.TraceIDRatioBased(0.1) for the requests of a route group.
+// The sampler decides on the trace id of the span, and the dropped requests are still recorded
+// in the metrics.
+func WithSampler(sampler sdktrace.Sampler) Option {
+	return option(func(cfg *Config) {
+		cfg.sampler = sampler
+	})
+}
+
+// WithRequestHeaderAttributes configures the request headers recorded as the server span
+// attributes http.request.header.<name>
+func WithRequestHeaderAttributes(headers ...string) Option {
+	return option(func(cfg *Config) {
+		cfg.requestHeaders = capturedHeaders("http.request.header.", headers)
+	})
+}
+
+// WithResponseHeaderAttributes configures the response headers recorded as the server span
+// attributes http.response.header.<name>
+func WithResponseHeaderAttributes(headers ...string) Option {
+	return option(func(cfg *Config) {
+		cfg.responseHeaders = capturedHeaders("http.response.header.", headers)
+	})
+}
+
+func capturedHeaders(prefix string, headers []string) []capturedHeader {
+	captured := make([]capturedHeader, 0, len(headers))
+	for _, header := range headers {
+		captured = append(captured, capturedHeader{name: header, key: headerAttributeKey(prefix, header)})
+	}
+	return captured
+}
+
+// WithKitexCompatibility configures the propagation compatible with kitex obs-opentelemetry:
+// the server reads the metainfo of the rpc-transit- and rpc-persist- headers into the context, so
+// the kitex clients called by the handlers forward it, and falls back to the peer service keys of
+// kitex (eg: rpc-transit-service.name), the client writes the metainfo of the context into the headers
+func WithKitexCompatibility(enable bool) Option {
+	return option(func(cfg *Config) {
+		cfg.kitexCompatibility = enable
+	})
+}
+
+// WithTraceIDResponseHeader configures the response header the trace id of the server span
+// is written into, eg: X-Trace-Id, so errors reported by users can be mapped to traces
+func WithTraceIDResponseHeader(header string) Option {
+	return option(func(cfg *Config) {
+		cfg.traceIDResponseHeader = header
+	})
+}
+
+// WithTraceResponse configures writing the W3C Trace Context Level 2 traceresponse header
+func WithTraceResponse(enable bool) Option {
+	return option(func(cfg *Config) {
+		cfg.traceResponse = enable
+	})
+}
+
+// WithTraceResponseCondition configures the condition of writing the trace response headers,
+// it runs after the handlers so it can check the route or the status code. Without a condition
+// the headers are written before the handlers, so streaming responses carry them as well
+func WithTraceResponseCondition(condition ConditionFunc) Option {
+	return option(func(cfg *Config) {
+		cfg.responseHeaderCondition = condition
+	})
 }
 
 // WithRecordSourceOperation configures record source operation dimension
@@ -128,6 +328,32 @@ func WithRecordSourceOperation(recordSourceOperation bool) Option {
 	})
 }
 
+// WithClientPhaseMetrics configures recording client connection phase histograms,
+// requires the client to dial with the dialer returned by NewDialer
+func WithClientPhaseMetrics(enable bool) Option {
+	return option(func(cfg *Config) {
+		cfg.clientPhaseMetrics = enable
+	})
+}
+
+// WithServerTimingMetrics configures recording server timing breakdown histograms
+// (read header, read body, handle and write), requires server.WithTraceLevel(stats.LevelDetailed)
+func WithServerTimingMetrics(enable bool) Option {
+	return option(func(cfg *Config) {
+		cfg.serverTimingMetrics = enable
+	})
+}
+
+// WithConnectionMetrics configures recording the connection of the requests on the server spans
+// (request count, idle and age) and the http.server.connection.* metrics. The tracer of
+// NewServerTracer registers server.WithOnAccept, the previous OnAccept is still called, so pass
+// the tracer after server.WithOnAccept. The connection metrics require the netpoll transport
+func WithConnectionMetrics(enable bool) Option {
+	return option(func(cfg *Config) {
+		cfg.connectionMetrics = enable
+	})
+}
+
 // WithTextMapPropagator configures propagation
 func WithTextMapPropagator(p propagation.TextMapPropagator) Option {
 	return option(func(cfg *Config) {
@@ -176,3 +402,66 @@ func WithShouldIgnore(condition ConditionFunc) Option {
 		cfg.shouldIgnore = condition
 	})
 }
+
+// WithErrorClassifier configures which request errors and panics mark the server span as error.
+// By default, panics and the errors of the server mark the span as error, while the errors
+// attached with c.Error follow the status mapping, eg: only mark errors of 5xx responses
+//
+//	WithErrorClassifier(func(ctx context.Context, c *app.RequestContext, err error) bool {
+//		return c.Response.StatusCode() >= consts.StatusInternalServerError
+//	})
+func WithErrorClassifier(classifier ErrorClassifierFunc) Option {
+	return option(func(cfg *Config) {
+		cfg.errorClassifier = classifier
+	})
+}
+
+// WithErrorAttributes configures a hook which attaches attributes, eg: domain error codes,
+// to the server span and its exception event when a request error or panic is recorded
+func WithErrorAttributes(fn ErrorAttributesFunc) Option {
+	return option(func(cfg *Config) {
+		cfg.errorAttributes = fn
+	})
+}
+
+// WithServerStatusMapper configures how the response status code maps to the server span status
+func WithServerStatusMapper(mapper ServerStatusMapperFunc) Option {
+	return option(func(cfg *Config) {
+		cfg.serverStatusMapper = mapper
+	})
+}
+
+// WithClientStatusMapper configures how the response status code maps to the client span status
+func WithClientStatusMapper(mapper ClientStatusMapperFunc) Option {
+	return option(func(cfg *Config) {
+		cfg.clientStatusMapper = mapper
+	})
+}
+
+// WithNonErrorStatusCodes configures status codes which never mark the span as error, eg: 404, 429
+func WithNonErrorStatusCodes(statusCodes ...int) Option {
+	return option(func(cfg *Config) {
+		if cfg.nonErrorStatusCodes == nil {
+			cfg.nonErrorStatusCodes = make(map[int]struct{}, len(statusCodes))
+		}
+		for _, code := range statusCodes {
+			cfg.nonErrorStatusCodes[code] = struct{}{}
+		}
+	})
+}
+
+// WithStreamTracing configures recording the chunks of streaming responses (chunked, SSE) and
+// the data exchanged over hijacked connections (WebSocket) as span events, the durations of
+// the streams are recorded in ServerStreamDuration instead of ServerLatency
+func WithStreamTracing(enable bool) Option {
+	return option(func(cfg *Config) {
+		cfg.streamTracing = enable
+	})
+}
+
+// WithStreamEventLimit configures the max number of message events recorded for a stream
+func WithStreamEventLimit(limit int) Option {
+	return option(func(cfg *Config) {
+		cfg.streamEventLimit = limit
+	})
+}
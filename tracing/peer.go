@@ -16,39 +16,82 @@ package tracing
 
 import (
 	"context"
+	"net"
+	"sort"
 	"strings"
 
+	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/protocol"
 	"go.opentelemetry.io/otel/attribute"
 	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
 )
 
-func injectPeerServiceToMetadata(_ context.Context, attrs []attribute.KeyValue) map[string]string {
+// PeerServiceHeaders are the names of the headers which propagate the service of the client.
+type PeerServiceHeaders struct {
+	ServiceName           string
+	ServiceNamespace      string
+	DeploymentEnvironment string
+}
+
+// defaultPeerServiceHeaders returns the header names derived from the semconv keys,
+// eg: service-name, service-namespace and deployment-environment.
+func defaultPeerServiceHeaders() PeerServiceHeaders {
+	return PeerServiceHeaders{
+		ServiceName:           semconvAttributeKeyToHTTPHeader(string(semconv.ServiceNameKey)),
+		ServiceNamespace:      semconvAttributeKeyToHTTPHeader(string(semconv.ServiceNamespaceKey)),
+		DeploymentEnvironment: semconvAttributeKeyToHTTPHeader(string(semconv.DeploymentEnvironmentKey)),
+	}
+}
+
+// withDefaults fills the empty header names with the default ones.
+func (h PeerServiceHeaders) withDefaults() PeerServiceHeaders {
+	defaults := defaultPeerServiceHeaders()
+	if h.ServiceName == "" {
+		h.ServiceName = defaults.ServiceName
+	}
+	if h.ServiceNamespace == "" {
+		h.ServiceNamespace = defaults.ServiceNamespace
+	}
+	if h.DeploymentEnvironment == "" {
+		h.DeploymentEnvironment = defaults.DeploymentEnvironment
+	}
+	return h
+}
+
+func (h PeerServiceHeaders) withPrefix(prefix string) PeerServiceHeaders {
+	return PeerServiceHeaders{
+		ServiceName:           prefix + h.ServiceName,
+		ServiceNamespace:      prefix + h.ServiceNamespace,
+		DeploymentEnvironment: prefix + h.DeploymentEnvironment,
+	}
+}
+
+func injectPeerServiceToMetadata(_ context.Context, attrs []attribute.KeyValue, names PeerServiceHeaders) map[string]string {
 	serviceName, serviceNamespace, deploymentEnv := getServiceFromResourceAttributes(attrs)
 
 	md := make(map[string]string, 3)
 
 	if serviceName != "" {
-		md[semconvAttributeKeyToHTTPHeader(string(semconv.ServiceNameKey))] = serviceName
+		md[names.ServiceName] = serviceName
 	}
 
 	if serviceNamespace != "" {
-		md[semconvAttributeKeyToHTTPHeader(string(semconv.ServiceNamespaceKey))] = serviceNamespace
+		md[names.ServiceNamespace] = serviceNamespace
 	}
 
 	if deploymentEnv != "" {
-		md[semconvAttributeKeyToHTTPHeader(string(semconv.DeploymentEnvironmentKey))] = deploymentEnv
+		md[names.DeploymentEnvironment] = deploymentEnv
 	}
 
 	return md
 }
 
-func extractPeerServiceAttributesFromMetadata(headers *protocol.RequestHeader) []attribute.KeyValue {
+func extractPeerServiceAttributesFromMetadata(headers *protocol.RequestHeader, names PeerServiceHeaders) []attribute.KeyValue {
 	var attrs []attribute.KeyValue
 
-	serviceName, serviceNamespace, deploymentEnv := headers.Get(semconvAttributeKeyToHTTPHeader(string(semconv.ServiceNameKey))),
-		headers.Get(semconvAttributeKeyToHTTPHeader(string(semconv.ServiceNamespaceKey))),
-		headers.Get(semconvAttributeKeyToHTTPHeader(string(semconv.DeploymentEnvironmentKey)))
+	serviceName, serviceNamespace, deploymentEnv := headers.Get(names.ServiceName),
+		headers.Get(names.ServiceNamespace),
+		headers.Get(names.DeploymentEnvironment)
 
 	if serviceName != "" {
 		attrs = append(attrs, semconv.PeerServiceKey.String(serviceName))
@@ -68,3 +111,131 @@ func extractPeerServiceAttributesFromMetadata(headers *protocol.RequestHeader) [
 func semconvAttributeKeyToHTTPHeader(key string) string {
 	return strings.ReplaceAll(key, ".", "-")
 }
+
+// shouldPropagatePeerService reports whether the service of the client is propagated to host,
+// host is without the port.
+func (cfg *Config) shouldPropagatePeerService(host string) bool {
+	if cfg.disablePeerServicePropagation {
+		return false
+	}
+	if len(cfg.peerServiceHosts) == 0 {
+		return true
+	}
+	return matchHost(cfg.peerServiceHosts, host)
+}
+
+// matchHost reports whether host matches any of the patterns case-insensitively, a pattern
+// is either a host name or a wildcard of the subdomains, eg: *.svc.cluster.local
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(strings.ToLower(host), strings.ToLower(pattern[1:])) {
+				return true
+			}
+		} else if strings.EqualFold(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func hostWithoutPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// PeerIPIn returns a condition which is true when the remote address of the connection is in
+// one of the cidrs, eg: 10.0.0.0/8. The X-Forwarded-For header is not trusted. Invalid cidrs panic.
+func PeerIPIn(cidrs ...string) ConditionFunc {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return func(ctx context.Context, c *app.RequestContext) bool {
+		addr := c.RemoteAddr()
+		if addr == nil {
+			return false
+		}
+		ip := net.ParseIP(hostWithoutPort(addr.String()))
+		if ip == nil {
+			return false
+		}
+		for _, ipNet := range nets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// PeerServiceFunc returns the peer.service of the destination of a client request,
+// an empty name means unknown.
+type PeerServiceFunc func(req *protocol.Request) string
+
+type peerServiceRule struct {
+	// hosts holds the host pattern of the rule, in the form of the patterns of matchHost
+	hosts   []string
+	path    string
+	service string
+}
+
+func newPeerServiceRules(services map[string]string) []peerServiceRule {
+	patterns := make([]string, 0, len(services))
+	for pattern := range services {
+		patterns = append(patterns, pattern)
+	}
+	// the most specific pattern first
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+
+	rules := make([]peerServiceRule, 0, len(patterns))
+	for _, pattern := range patterns {
+		host, path := pattern, ""
+		if i := strings.IndexByte(pattern, '/'); i >= 0 {
+			host, path = pattern[:i], pattern[i:]
+		}
+		rules = append(rules, peerServiceRule{hosts: []string{host}, path: path, service: services[pattern]})
+	}
+	return rules
+}
+
+// clientPeerService returns the peer.service of the client request to host.
+func (cfg *Config) clientPeerService(req *protocol.Request, host string) string {
+	if cfg.clientPeerServiceFunc != nil {
+		if service := cfg.clientPeerServiceFunc(req); service != "" {
+			return service
+		}
+	}
+	if len(cfg.clientPeerServiceRules) == 0 {
+		return ""
+	}
+
+	path := string(req.URI().Path())
+	for _, rule := range cfg.clientPeerServiceRules {
+		if matchHost(rule.hosts, host) && matchPathPrefix(path, rule.path) {
+			return rule.service
+		}
+	}
+	return ""
+}
+
+// matchPathPrefix reports whether path is prefix or under it, eg: /v2/orders matches
+// /v2/orders and /v2/orders/1 but not /v2/ordersfoo.
+func matchPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
@@ -0,0 +1,199 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/mock"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+type remoteAddrConn struct {
+	*mock.Conn
+	addr net.Addr
+}
+
+func (c *remoteAddrConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func TestShouldPropagatePeerService(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		host string
+		want bool
+	}{
+		{name: "default", host: "example.com", want: true},
+		{name: "disabled", opts: []Option{WithPeerServicePropagation(false)}, host: "example.com", want: false},
+		{name: "exact host", opts: []Option{WithPeerServiceHosts("user.svc")}, host: "user.svc", want: true},
+		{name: "wildcard host", opts: []Option{WithPeerServiceHosts("*.svc.cluster.local")}, host: "user.svc.cluster.local", want: true},
+		{name: "wildcard mixed case", opts: []Option{WithPeerServiceHosts("*.svc.cluster.local")}, host: "User.SVC.cluster.local", want: true},
+		{name: "wildcard apex", opts: []Option{WithPeerServiceHosts("*.svc.cluster.local")}, host: "svc.cluster.local", want: false},
+		{name: "external host", opts: []Option{WithPeerServiceHosts("user.svc", "*.svc.cluster.local")}, host: "api.example.com", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig(tt.opts)
+			assert.Equal(t, tt.want, cfg.shouldPropagatePeerService(tt.host))
+		})
+	}
+}
+
+func TestPeerServiceHeaders(t *testing.T) {
+	attrs := []attribute.KeyValue{
+		semconv.ServiceNameKey.String("client"),
+		semconv.ServiceNamespaceKey.String("ns"),
+		semconv.DeploymentEnvironmentKey.String("prod"),
+	}
+
+	cfg := newConfig(nil)
+	assert.Equal(t, map[string]string{
+		"service-name":           "client",
+		"service-namespace":      "ns",
+		"deployment-environment": "prod",
+	}, injectPeerServiceToMetadata(context.Background(), attrs, cfg.peerServiceHeaders))
+
+	cfg = newConfig([]Option{WithPeerServiceHeaderPrefix("x-")})
+	md := injectPeerServiceToMetadata(context.Background(), attrs, cfg.peerServiceHeaders)
+	assert.Equal(t, "client", md["x-service-name"])
+
+	cfg = newConfig([]Option{WithPeerServiceHeaders(PeerServiceHeaders{
+		ServiceName:           "x-caller",
+		ServiceNamespace:      "x-caller-ns",
+		DeploymentEnvironment: "x-caller-env",
+	})})
+	md = injectPeerServiceToMetadata(context.Background(), attrs, cfg.peerServiceHeaders)
+
+	var header protocol.RequestHeader
+	for k, v := range md {
+		header.Set(k, v)
+	}
+	assert.Equal(t, "client", header.Get("x-caller"))
+	assert.Equal(t, []attribute.KeyValue{
+		semconv.PeerServiceKey.String("client"),
+		PeerServiceNamespaceKey.String("ns"),
+		PeerDeploymentEnvironmentKey.String("prod"),
+	}, extractPeerServiceAttributesFromMetadata(&header, cfg.peerServiceHeaders))
+
+	// the names left empty are the default ones
+	cfg = newConfig([]Option{WithPeerServiceHeaders(PeerServiceHeaders{ServiceName: "x-caller"})})
+	assert.Equal(t, map[string]string{
+		"x-caller":               "client",
+		"service-namespace":      "ns",
+		"deployment-environment": "prod",
+	}, injectPeerServiceToMetadata(context.Background(), attrs, cfg.peerServiceHeaders))
+
+	cfg = newConfig([]Option{
+		WithPeerServiceHeaders(PeerServiceHeaders{ServiceName: "caller"}),
+		WithPeerServiceHeaderPrefix("x-"),
+	})
+	assert.Equal(t, map[string]string{
+		"x-caller":                 "client",
+		"x-service-namespace":      "ns",
+		"x-deployment-environment": "prod",
+	}, injectPeerServiceToMetadata(context.Background(), attrs, cfg.peerServiceHeaders))
+}
+
+func TestPeerIPIn(t *testing.T) {
+	trusted := PeerIPIn("10.0.0.0/8", "::1/128")
+
+	newContext := func(addr net.Addr) *app.RequestContext {
+		c := app.NewContext(0)
+		c.SetConn(&remoteAddrConn{Conn: mock.NewConn(""), addr: addr})
+		c.Request.Header.Set(headerXForwardedFor, "10.0.0.1")
+		return c
+	}
+
+	assert.True(t, trusted(context.Background(), newContext(&net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 80})))
+	assert.True(t, trusted(context.Background(), newContext(&net.TCPAddr{IP: net.ParseIP("::1"), Port: 80})))
+	assert.False(t, trusted(context.Background(), newContext(&net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 80})))
+	assert.False(t, trusted(context.Background(), app.NewContext(0)))
+
+	assert.Panics(t, func() { PeerIPIn("10.0.0.0") })
+}
+
+func TestClientPeerService(t *testing.T) {
+	cfg := newConfig([]Option{
+		WithClientPeerServices(map[string]string{
+			"api.stripe.com":            "stripe",
+			"*.s3.amazonaws.com":        "s3",
+			"api.example.com":           "example",
+			"api.example.com/v2/orders": "orders",
+		}),
+	})
+
+	peerService := func(uri string) string {
+		req := protocol.NewRequest("GET", uri, nil)
+		return cfg.clientPeerService(req, hostWithoutPort(string(req.Host())))
+	}
+
+	assert.Equal(t, "stripe", peerService("https://api.stripe.com/v1/charges"))
+	assert.Equal(t, "s3", peerService("https://bucket.s3.amazonaws.com:443/key"))
+	assert.Equal(t, "orders", peerService("https://api.example.com/v2/orders/1"))
+	assert.Equal(t, "example", peerService("https://api.example.com/v2/users/1"))
+	assert.Equal(t, "orders", peerService("https://api.example.com/v2/orders"))
+	assert.Equal(t, "example", peerService("https://api.example.com/v2/ordersfoo"))
+	assert.Equal(t, "", peerService("https://www.example.com/"))
+
+	cfg = newConfig([]Option{
+		WithClientPeerServices(map[string]string{"*.example.com": "example"}),
+		WithClientPeerServiceFunc(func(req *protocol.Request) string {
+			return string(req.Header.Peek("X-Peer-Service"))
+		}),
+	})
+	req := protocol.NewRequest("GET", "https://api.example.com/", nil)
+	assert.Equal(t, "example", cfg.clientPeerService(req, "api.example.com"))
+	req.Header.Set("X-Peer-Service", "gateway")
+	assert.Equal(t, "gateway", cfg.clientPeerService(req, "api.example.com"))
+}
+
+func TestClientMiddlewarePeerService(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	mw := ClientMiddleware(
+		WithClientPeerServices(map[string]string{"user-service": "user"}),
+		WithPeerServiceHosts("*.svc.cluster.local"),
+	)
+	// the service discovery middleware resolves the host of the request in next
+	endpoint := mw(func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+		req.SetHost("10.0.0.1:8888")
+		resp.SetStatusCode(200)
+		return nil
+	})
+
+	req, resp := protocol.AcquireRequest(), protocol.AcquireResponse()
+	defer protocol.ReleaseRequest(req)
+	defer protocol.ReleaseResponse(resp)
+	req.SetRequestURI("http://user-service/user/1")
+
+	assert.Nil(t, endpoint(context.Background(), req, resp))
+	assert.Equal(t, "", req.Header.Get("service-name"))
+
+	spans := sr.Ended()
+	assert.Len(t, spans, 1)
+	assert.True(t, hasAttribute(spans[0].Attributes(), semconv.PeerServiceKey.String("user")))
+}
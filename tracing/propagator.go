@@ -16,6 +16,7 @@ package tracing
 
 import (
 	"context"
+	"strings"
 
 	"github.com/cloudwego/hertz/pkg/protocol"
 	"go.opentelemetry.io/otel/baggage"
@@ -23,16 +24,44 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
-var _ propagation.TextMapCarrier = &metadataProvider{}
+// headers is implemented by both protocol.RequestHeader and protocol.ResponseHeader.
+type headers interface {
+	Set(key, value string)
+	PeekAll(key string) [][]byte
+	VisitAll(f func(key, value []byte))
+}
+
+var (
+	_ propagation.TextMapCarrier = &metadataProvider{}
+	_ headers                    = &protocol.RequestHeader{}
+	_ headers                    = &protocol.ResponseHeader{}
+)
 
 type metadataProvider struct {
-	metadata map[string]string
-	headers  *protocol.RequestHeader
+	headers headers
 }
 
-// Get a value from metadata by key
+// Get a value from metadata by key, the values of a repeated header are joined by commas
 func (m *metadataProvider) Get(key string) string {
-	return m.headers.Get(key)
+	values := m.headers.PeekAll(key)
+	switch len(values) {
+	case 0:
+		return ""
+	case 1:
+		return string(values[0])
+	}
+	return strings.Join(m.Values(key), ",")
+}
+
+// Values returns all values of a repeated header by key, it implements
+// the propagation.ValuesGetter interface of newer opentelemetry versions
+func (m *metadataProvider) Values(key string) []string {
+	values := m.headers.PeekAll(key)
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		out = append(out, string(v))
+	}
+	return out
 }
 
 // Set a value to metadata by k/v
@@ -40,24 +69,96 @@ func (m *metadataProvider) Set(key, value string) {
 	m.headers.Set(key, value)
 }
 
-// Keys Iteratively get all keys of metadata
+// Keys Iteratively get all keys of metadata, the key of a repeated header is returned once
 func (m *metadataProvider) Keys() []string {
-	out := make([]string, 0, len(m.metadata))
+	var out []string
 
 	m.headers.VisitAll(func(key, value []byte) {
+		for _, k := range out {
+			if k == string(key) {
+				return
+			}
+		}
 		out = append(out, string(key))
 	})
 
 	return out
 }
 
+// bytesMapCarrier adapts the headers with byte values, eg: kafka record headers, to propagation.TextMapCarrier.
+type bytesMapCarrier map[string][]byte
+
+var _ propagation.TextMapCarrier = bytesMapCarrier{}
+
+// Get a value from the headers by key
+func (m bytesMapCarrier) Get(key string) string {
+	return string(m[key])
+}
+
+// Set a value to the headers by k/v
+func (m bytesMapCarrier) Set(key, value string) {
+	m[key] = []byte(value)
+}
+
+// Keys returns all keys of the headers
+func (m bytesMapCarrier) Keys() []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
+
 // Inject injects span context into the hertz metadata info
 func Inject(ctx context.Context, c *Config, headers *protocol.RequestHeader) {
-	c.textMapPropagator.Inject(ctx, &metadataProvider{headers: headers})
+	propagatorOf(c).Inject(ctx, &metadataProvider{headers: headers})
 }
 
 // Extract returns the baggage and span context
 func Extract(ctx context.Context, c *Config, headers *protocol.RequestHeader) (baggage.Baggage, trace.SpanContext) {
-	ctx = c.textMapPropagator.Extract(ctx, &metadataProvider{headers: headers})
+	ctx = propagatorOf(c).Extract(ctx, &metadataProvider{headers: headers})
 	return baggage.FromContext(ctx), trace.SpanContextFromContext(ctx)
 }
+
+// InjectResponse injects span context into the response headers, for protocols
+// which return the context of the server in the response
+func InjectResponse(ctx context.Context, c *Config, headers *protocol.ResponseHeader) {
+	propagatorOf(c).Inject(ctx, &metadataProvider{headers: headers})
+}
+
+// ExtractResponse returns the baggage and span context in the response headers
+func ExtractResponse(ctx context.Context, c *Config, headers *protocol.ResponseHeader) (baggage.Baggage, trace.SpanContext) {
+	ctx = propagatorOf(c).Extract(ctx, &metadataProvider{headers: headers})
+	return baggage.FromContext(ctx), trace.SpanContextFromContext(ctx)
+}
+
+// InjectCarrier injects span context into any carrier, eg: an adapter of the headers of a message
+func InjectCarrier(ctx context.Context, c *Config, carrier propagation.TextMapCarrier) {
+	propagatorOf(c).Inject(ctx, carrier)
+}
+
+// ExtractCarrier returns the baggage and span context in the carrier
+func ExtractCarrier(ctx context.Context, c *Config, carrier propagation.TextMapCarrier) (baggage.Baggage, trace.SpanContext) {
+	ctx = propagatorOf(c).Extract(ctx, carrier)
+	return baggage.FromContext(ctx), trace.SpanContextFromContext(ctx)
+}
+
+// InjectMap injects span context into the headers of a message
+func InjectMap(ctx context.Context, c *Config, headers map[string]string) {
+	InjectCarrier(ctx, c, propagation.MapCarrier(headers))
+}
+
+// ExtractMap returns the baggage and span context in the headers of a message
+func ExtractMap(ctx context.Context, c *Config, headers map[string]string) (baggage.Baggage, trace.SpanContext) {
+	return ExtractCarrier(ctx, c, propagation.MapCarrier(headers))
+}
+
+// InjectBytes injects span context into the headers with byte values, eg: kafka record headers
+func InjectBytes(ctx context.Context, c *Config, headers map[string][]byte) {
+	InjectCarrier(ctx, c, bytesMapCarrier(headers))
+}
+
+// ExtractBytes returns the baggage and span context in the headers with byte values
+func ExtractBytes(ctx context.Context, c *Config, headers map[string][]byte) (baggage.Baggage, trace.SpanContext) {
+	return ExtractCarrier(ctx, c, bytesMapCarrier(headers))
+}
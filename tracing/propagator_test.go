@@ -24,6 +24,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"go.opentelemetry.io/contrib/propagators/b3"
 	"go.opentelemetry.io/contrib/propagators/ot"
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
@@ -121,3 +122,97 @@ func TestInject(t *testing.T) {
 		})
 	}
 }
+
+func TestMetadataProviderMultiValues(t *testing.T) {
+	headers := &protocol.RequestHeader{}
+	headers.Add("baggage", "foo=bar")
+	headers.Add("baggage", "hello=world")
+	headers.Set("traceparent", "00-01000000000000000000000000000000-0200000000000000-01")
+
+	carrier := &metadataProvider{headers: headers}
+	assert.Equal(t, []string{"foo=bar", "hello=world"}, carrier.Values("baggage"))
+	assert.Equal(t, "foo=bar,hello=world", carrier.Get("baggage"))
+	assert.Equal(t, "00-01000000000000000000000000000000-0200000000000000-01", carrier.Get("traceparent"))
+	assert.Equal(t, "", carrier.Get("missing"))
+	assert.Empty(t, carrier.Values("missing"))
+	assert.ElementsMatch(t, []string{"Baggage", "Traceparent"}, carrier.Keys())
+
+	// the baggage of all repeated headers is extracted
+	cfg := newConfig([]Option{WithTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.Baggage{},
+		propagation.TraceContext{},
+	))})
+	bags, spanCtx := Extract(context.Background(), cfg, headers)
+	assert.Equal(t, "bar", bags.Member("foo").Value())
+	assert.Equal(t, "world", bags.Member("hello").Value())
+	assert.True(t, spanCtx.IsValid())
+}
+
+func TestInjectExtractResponse(t *testing.T) {
+	cfg := newConfig([]Option{WithTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.Baggage{},
+		propagation.TraceContext{},
+	))})
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    [16]byte{1},
+		SpanID:     [8]byte{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	member, _ := baggage.NewMember("foo", "bar")
+	bags, _ := baggage.New(member)
+	ctx := baggage.ContextWithBaggage(trace.ContextWithSpanContext(context.Background(), spanContext), bags)
+
+	headers := &protocol.ResponseHeader{}
+	InjectResponse(ctx, cfg, headers)
+	assert.Equal(t, "00-01000000000000000000000000000000-0200000000000000-01", headers.Get("traceparent"))
+	assert.Equal(t, "foo=bar", headers.Get("baggage"))
+
+	gotBags, gotSpanCtx := ExtractResponse(context.Background(), cfg, headers)
+	assert.Equal(t, "bar", gotBags.Member("foo").Value())
+	assert.Equal(t, spanContext.TraceID(), gotSpanCtx.TraceID())
+	assert.Equal(t, spanContext.SpanID(), gotSpanCtx.SpanID())
+	assert.True(t, gotSpanCtx.IsRemote())
+}
+
+func TestInjectExtractMessageHeaders(t *testing.T) {
+	cfg := newConfig([]Option{WithTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.Baggage{},
+		propagation.TraceContext{},
+	))})
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    [16]byte{1},
+		SpanID:     [8]byte{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	member, _ := baggage.NewMember("foo", "bar")
+	bags, _ := baggage.New(member)
+	ctx := baggage.ContextWithBaggage(trace.ContextWithSpanContext(context.Background(), spanContext), bags)
+
+	headers := map[string]string{}
+	InjectMap(ctx, cfg, headers)
+	assert.Equal(t, "00-01000000000000000000000000000000-0200000000000000-01", headers["traceparent"])
+	assert.Equal(t, "foo=bar", headers["baggage"])
+
+	gotBags, gotSpanCtx := ExtractMap(context.Background(), cfg, headers)
+	assert.Equal(t, "bar", gotBags.Member("foo").Value())
+	assert.Equal(t, spanContext.TraceID(), gotSpanCtx.TraceID())
+	assert.True(t, gotSpanCtx.IsRemote())
+
+	byteHeaders := map[string][]byte{}
+	InjectBytes(ctx, cfg, byteHeaders)
+	assert.Equal(t, []byte("00-01000000000000000000000000000000-0200000000000000-01"), byteHeaders["traceparent"])
+
+	gotBags, gotSpanCtx = ExtractBytes(context.Background(), cfg, byteHeaders)
+	assert.Equal(t, "bar", gotBags.Member("foo").Value())
+	assert.Equal(t, spanContext.SpanID(), gotSpanCtx.SpanID())
+
+	// the global propagator is used without a config
+	defer otel.SetTextMapPropagator(otel.GetTextMapPropagator())
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	headers = map[string]string{}
+	InjectMap(ctx, nil, headers)
+	assert.Equal(t, "00-01000000000000000000000000000000-0200000000000000-01", headers["traceparent"])
+	assert.Empty(t, headers["baggage"])
+}
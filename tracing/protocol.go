@@ -0,0 +1,80 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+const (
+	transportTCP = "tcp"
+	transportUDP = "udp"
+)
+
+// serverProtocol returns the http version and the transport of the request,
+// eg: "1.1" over "tcp", "2" over "tcp" and "3" over "udp".
+func serverProtocol(c *app.RequestContext) (version, transport string) {
+	version = parseHTTPVersion(c.Request.Header.GetProtocol())
+
+	transport = transportTCP
+	if strings.HasPrefix(version, "3") {
+		transport = transportUDP
+	} else if conn := c.GetConn(); conn != nil && conn.RemoteAddr() != nil &&
+		strings.HasPrefix(conn.RemoteAddr().Network(), transportUDP) {
+		transport = transportUDP
+	}
+	return
+}
+
+// parseHTTPVersion parses the version of a hertz protocol, eg: HTTP/1.1, HTTP/2.0.
+// Versions since http/2 are returned without the minor version.
+func parseHTTPVersion(protocol string) string {
+	if len(protocol) < 5 || !strings.EqualFold(protocol[:5], "HTTP/") {
+		return "1.1"
+	}
+	version := protocol[5:]
+	if version != "" && version[0] >= '2' {
+		version = strings.TrimSuffix(version, ".0")
+	}
+	return version
+}
+
+// protocolAttributes returns the network protocol attributes of the http version and transport.
+func protocolAttributes(version, transport string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		NetworkProtocolNameKey.String("http"),
+		NetworkProtocolVersionKey.String(version),
+		NetworkTransportKey.String(transport),
+	}
+}
+
+// httpFlavor returns the http.flavor attribute of the http version.
+func httpFlavor(version string) (attribute.KeyValue, bool) {
+	switch version {
+	case "1.0":
+		return semconv.HTTPFlavorHTTP10, true
+	case "1.1":
+		return semconv.HTTPFlavorHTTP11, true
+	case "2":
+		return semconv.HTTPFlavorHTTP20, true
+	case "3":
+		return semconv.HTTPFlavorQUIC, true
+	}
+	return attribute.KeyValue{}, false
+}
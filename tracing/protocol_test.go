@@ -0,0 +1,74 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+func TestServerProtocol(t *testing.T) {
+	tests := []struct {
+		protocol  string
+		version   string
+		transport string
+	}{
+		{protocol: "", version: "1.1", transport: "tcp"},
+		{protocol: consts.HTTP10, version: "1.0", transport: "tcp"},
+		{protocol: consts.HTTP11, version: "1.1", transport: "tcp"},
+		{protocol: consts.HTTP20, version: "2", transport: "tcp"},
+		{protocol: "HTTP/3", version: "3", transport: "udp"},
+		{protocol: "HTTP/3.0", version: "3", transport: "udp"},
+	}
+	for _, tt := range tests {
+		c := app.NewContext(0)
+		c.Request.Header.SetProtocol(tt.protocol)
+		version, transport := serverProtocol(c)
+		assert.Equal(t, tt.version, version, tt.protocol)
+		assert.Equal(t, tt.transport, transport, tt.protocol)
+	}
+}
+
+func TestProtocolAttributes(t *testing.T) {
+	attrs := protocolAttributes("2", "tcp")
+	assert.Contains(t, attrs, NetworkProtocolNameKey.String("http"))
+	assert.Contains(t, attrs, NetworkProtocolVersionKey.String("2"))
+	assert.Contains(t, attrs, NetworkTransportKey.String("tcp"))
+
+	attrs = protocolAttributes("3", "udp")
+	assert.Contains(t, attrs, NetworkTransportKey.String("udp"))
+}
+
+func TestHTTPFlavor(t *testing.T) {
+	tests := map[string]attribute.KeyValue{
+		"1.0": semconv.HTTPFlavorHTTP10,
+		"1.1": semconv.HTTPFlavorHTTP11,
+		"2":   semconv.HTTPFlavorHTTP20,
+		"3":   semconv.HTTPFlavorQUIC,
+	}
+	for version, want := range tests {
+		flavor, ok := httpFlavor(version)
+		assert.True(t, ok, version)
+		assert.Equal(t, want, flavor, version)
+	}
+
+	_, ok := httpFlavor("0.9")
+	assert.False(t, ok)
+}
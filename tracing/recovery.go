@@ -0,0 +1,68 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+// RecoveryHandlerFunc is the signature of the hertz recovery middleware handler.
+type RecoveryHandlerFunc func(c context.Context, ctx *app.RequestContext, err interface{}, stack []byte)
+
+// panicError wraps a recovered panic value with the stack it was raised from.
+type panicError struct {
+	value interface{}
+	stack string
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("%v", e.value)
+}
+
+func (e *panicError) Stack() string {
+	return e.stack
+}
+
+// RecoveryHandler wraps a hertz recovery handler so the recovered panic is
+// recorded as an escaped exception on the server span, eg:
+//
+//	h.Use(recovery.Recovery(recovery.WithRecoveryHandler(tracing.RecoveryHandler(nil))))
+//
+// A nil handler logs the panic and aborts with 500 like the hertz default handler.
+func RecoveryHandler(handler RecoveryHandlerFunc) RecoveryHandlerFunc {
+	if handler == nil {
+		handler = defaultRecoveryHandler
+	}
+	return func(c context.Context, ctx *app.RequestContext, err interface{}, stack []byte) {
+		pe := &panicError{value: err, stack: string(stack)}
+		if ti := ctx.GetTraceInfo(); ti != nil {
+			ti.Stats().SetPanicked(pe)
+		} else {
+			// the server runs without tracers, keep the panic in the request errors
+			_ = ctx.Error(pe)
+		}
+		handler(c, ctx, err, stack)
+	}
+}
+
+func defaultRecoveryHandler(c context.Context, ctx *app.RequestContext, err interface{}, stack []byte) {
+	hlog.SystemLogger().CtxErrorf(c, "[Recovery] err=%v\nstack=%s", err, stack)
+	ctx.AbortWithStatus(consts.StatusInternalServerError)
+}
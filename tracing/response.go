@@ -0,0 +1,48 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"github.com/cloudwego/hertz/pkg/app"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceResponseHeader is the response header of W3C Trace Context Level 2,
+// ref to https://www.w3.org/TR/trace-context-2/#traceresponse-header
+const TraceResponseHeader = "traceresponse"
+
+const traceResponseVersion = "00"
+
+// traceResponseHeadersEnabled reports whether any trace response header is configured.
+func (cfg *Config) traceResponseHeadersEnabled() bool {
+	return cfg.traceIDResponseHeader != "" || cfg.traceResponse
+}
+
+// injectTraceResponseHeaders writes the trace id and the traceresponse of the
+// server span into the response header.
+func (cfg *Config) injectTraceResponseHeaders(c *app.RequestContext, spanCtx trace.SpanContext) {
+	if !spanCtx.IsValid() {
+		return
+	}
+	if cfg.traceIDResponseHeader != "" {
+		c.Response.Header.Set(cfg.traceIDResponseHeader, spanCtx.TraceID().String())
+	}
+	if cfg.traceResponse {
+		c.Response.Header.Set(TraceResponseHeader, traceResponseVersion+"-"+
+			spanCtx.TraceID().String()+"-"+
+			spanCtx.SpanID().String()+"-"+
+			spanCtx.TraceFlags().String())
+	}
+}
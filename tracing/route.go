@@ -0,0 +1,90 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// RoutePolicy decides the route of requests which are not served by a regular route,
+// the route is used by both the span name and the http.route attribute.
+type RoutePolicy int
+
+const (
+	// RoutePolicyDefault keeps the route template of static routes, eg: /static/*filepath,
+	// and falls back to the raw request path for unmatched routes.
+	RoutePolicyDefault RoutePolicy = iota
+	// RoutePolicyMethodOnly records no http.route and names the span by the method only, eg: HTTP GET.
+	RoutePolicyMethodOnly
+	// RoutePolicyPlaceholder uses NotFoundRoute for unmatched routes and StaticRoute for static routes.
+	RoutePolicyPlaceholder
+)
+
+// Route placeholders of RoutePolicyPlaceholder.
+const (
+	NotFoundRoute = "NOT_FOUND"
+	StaticRoute   = "STATIC"
+)
+
+// staticHandlerName is the name suffix of the handlers created by app.FS.
+const staticHandlerName = "/app.(*fsHandler).handleRequest-fm"
+
+// serverRoute returns the route of the request, an empty route means the route is not recorded.
+func (cfg *Config) serverRoute(c *app.RequestContext) string {
+	// FullPath returns a matched route full path. For not found routes
+	// returns an empty string.
+	route := c.FullPath()
+
+	var policy RoutePolicy
+	var placeholder string
+	switch {
+	case cfg.staticRoutePolicy != RoutePolicyDefault && isStaticHandler(c):
+		policy, placeholder = cfg.staticRoutePolicy, StaticRoute
+	case route == "":
+		policy, placeholder = cfg.unmatchedRoutePolicy, NotFoundRoute
+	default:
+		return route
+	}
+
+	switch policy {
+	case RoutePolicyMethodOnly:
+		return ""
+	case RoutePolicyPlaceholder:
+		return placeholder
+	}
+	// fall back to path
+	if route == "" {
+		route = string(c.Path())
+	}
+	return route
+}
+
+// serverSpanName returns the span name of the request,
+// ref to https://github.com/open-telemetry/opentelemetry-specification/blob/ffddc289462dfe0c2041e3ca42a7b1df805706de/specification/trace/api.md#span
+func (cfg *Config) serverSpanName(c *app.RequestContext) string {
+	route := cfg.serverRoute(c)
+	if route == "" {
+		return "HTTP " + string(c.Method())
+	}
+	return string(c.Method()) + " " + route
+}
+
+// isStaticHandler reports whether the request is served by a static file handler,
+// either registered by Static, StaticFS or as the NoRoute handler.
+func isStaticHandler(c *app.RequestContext) bool {
+	return strings.HasSuffix(c.HandlerName(), staticHandlerName)
+}
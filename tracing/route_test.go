@@ -0,0 +1,100 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRouteTestContext(fullPath, path string, handler app.HandlerFunc) *app.RequestContext {
+	c := app.NewContext(0)
+	c.Request.SetRequestURI(path)
+	c.Request.Header.SetMethod("GET")
+	c.SetFullPath(fullPath)
+	c.SetHandlers(app.HandlersChain{handler})
+	return c
+}
+
+func TestServerRoutePolicy(t *testing.T) {
+	handler := func(ctx context.Context, c *app.RequestContext) {}
+	staticHandler := (&app.FS{Root: "."}).NewRequestHandler()
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		c        *app.RequestContext
+		route    string
+		spanName string
+	}{
+		{
+			name:     "matched",
+			opts:     []Option{WithUnmatchedRoutePolicy(RoutePolicyPlaceholder), WithStaticRoutePolicy(RoutePolicyPlaceholder)},
+			c:        newRouteTestContext("/user/:id", "/user/1", handler),
+			route:    "/user/:id",
+			spanName: "GET /user/:id",
+		},
+		{
+			name:     "unmatched default",
+			c:        newRouteTestContext("", "/wp-login.php", handler),
+			route:    "/wp-login.php",
+			spanName: "GET /wp-login.php",
+		},
+		{
+			name:     "unmatched method only",
+			opts:     []Option{WithUnmatchedRoutePolicy(RoutePolicyMethodOnly)},
+			c:        newRouteTestContext("", "/wp-login.php", handler),
+			route:    "",
+			spanName: "HTTP GET",
+		},
+		{
+			name:     "unmatched placeholder",
+			opts:     []Option{WithUnmatchedRoutePolicy(RoutePolicyPlaceholder)},
+			c:        newRouteTestContext("", "/wp-login.php", handler),
+			route:    NotFoundRoute,
+			spanName: "GET " + NotFoundRoute,
+		},
+		{
+			name:     "static default",
+			c:        newRouteTestContext("/static/*filepath", "/static/app.js", staticHandler),
+			route:    "/static/*filepath",
+			spanName: "GET /static/*filepath",
+		},
+		{
+			name:     "static placeholder",
+			opts:     []Option{WithStaticRoutePolicy(RoutePolicyPlaceholder)},
+			c:        newRouteTestContext("/static/*filepath", "/static/app.js", staticHandler),
+			route:    StaticRoute,
+			spanName: "GET " + StaticRoute,
+		},
+		{
+			name:     "static no route",
+			opts:     []Option{WithStaticRoutePolicy(RoutePolicyMethodOnly), WithUnmatchedRoutePolicy(RoutePolicyPlaceholder)},
+			c:        newRouteTestContext("", "/app.js", staticHandler),
+			route:    "",
+			spanName: "HTTP GET",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig(tt.opts)
+			assert.Equal(t, tt.route, cfg.serverHttpRouteFormatter(tt.c))
+			assert.Equal(t, tt.spanName, cfg.serverSpanNameFormatter(tt.c))
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// shouldSample reports whether the server span of the trace traceID is sampled by the sampler
+// of the config, the decision of the tracer provider still applies to the sampled spans.
+func (cfg *Config) shouldSample(ctx context.Context, traceID oteltrace.TraceID, name string) bool {
+	if cfg.sampler == nil {
+		return true
+	}
+
+	result := cfg.sampler.ShouldSample(sdktrace.SamplingParameters{
+		ParentContext: ctx,
+		TraceID:       traceID,
+		Name:          name,
+		Kind:          oteltrace.SpanKindServer,
+	})
+	return result.Decision != sdktrace.Drop
+}
+
+// droppedSpan is a server span dropped by the sampler of the config, it is propagated as not
+// sampled. The span of the tracer provider still records the request for the metrics, and is
+// never ended so it is not exported.
+type droppedSpan struct {
+	oteltrace.Span
+	spanContext oteltrace.SpanContext
+}
+
+func newDroppedSpan(span oteltrace.Span) *droppedSpan {
+	sc := span.SpanContext()
+	return &droppedSpan{
+		Span:        span,
+		spanContext: sc.WithTraceFlags(sc.TraceFlags().WithSampled(false)),
+	}
+}
+
+func (s *droppedSpan) SpanContext() oteltrace.SpanContext {
+	return s.spanContext
+}
+
+func (s *droppedSpan) End(...oteltrace.SpanEndOption) {}
@@ -47,3 +47,48 @@ const (
 const (
 	StatusKey = attribute.Key("status.code")
 )
+
+// Network protocol attribute keys, ref to https://github.com/open-telemetry/semantic-conventions/blob/v1.21.0/docs/general/attributes.md#network-attributes
+const (
+	NetworkProtocolNameKey    = attribute.Key("network.protocol.name")    // http
+	NetworkProtocolVersionKey = attribute.Key("network.protocol.version") // 1.0, 1.1, 2 or 3
+	NetworkTransportKey       = attribute.Key("network.transport")        // tcp or udp
+)
+
+const (
+	// ConnReusedKey whether the client request was sent over a connection taken from the pool,
+	// or the server request was received over a keep-alive connection.
+	ConnReusedKey = attribute.Key("http.conn.reused")
+)
+
+// Attribute keys of the connection of server requests, recorded when WithConnectionMetrics is enabled.
+const (
+	ConnRequestsKey     = attribute.Key("http.conn.requests")      // number of the request on the connection, 1 for the first request
+	ConnIdleDurationKey = attribute.Key("http.conn.idle_duration") // milliseconds waiting on the connection since accept or the previous response
+	ConnAgeKey          = attribute.Key("http.conn.age")           // milliseconds since the connection was accepted
+)
+
+// Attribute keys of streaming responses.
+const (
+	StreamKindKey             = attribute.Key("http.stream.kind")              // chunked, sse, websocket or hijacked
+	StreamSentMessagesKey     = attribute.Key("http.stream.sent_messages")     // number of chunks or messages sent
+	StreamReceivedMessagesKey = attribute.Key("http.stream.received_messages") // number of messages received over a hijacked connection
+	StreamSentBytesKey        = attribute.Key("http.stream.sent_bytes")        // total bytes sent
+	StreamReceivedBytesKey    = attribute.Key("http.stream.received_bytes")    // total bytes received over a hijacked connection
+	StreamDroppedEventsKey    = attribute.Key("http.stream.dropped_events")    // number of message events dropped due to the event limit
+)
+
+// Attribute keys of traced handlers.
+const (
+	HandlerNameKey     = attribute.Key("http.handler.name")     // name of the handler function
+	HandlerDurationKey = attribute.Key("http.handler.duration") // duration in milliseconds, including the handlers called by c.Next
+)
+
+// Attribute keys of client requests sent with service discovery.
+const (
+	DiscoveryServiceKey  = attribute.Key("http.client.discovery.service")  // logical service name, the host of the request before discovery
+	DiscoveryInstanceKey = attribute.Key("http.client.discovery.instance") // address of the picked instance
+	DiscoveryResolverKey = attribute.Key("http.client.discovery.resolver") // name of the resolver
+	DiscoveryBalancerKey = attribute.Key("http.client.discovery.balancer") // name of the load balancer
+	DiscoveryLatencyKey  = attribute.Key("http.client.discovery.latency")  // duration of resolving and picking the instance in milliseconds
+)
@@ -0,0 +1,67 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/hertz-contrib/obs-opentelemetry/tracing/internal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// serverSpanKey is the key of the server span in the RequestContext keys.
+const serverSpanKey = "github.com/hertz-contrib/obs-opentelemetry/tracing.server_span"
+
+// StartSpan starts an internal span with the tracer configured by NewServerTracer, the
+// span is a child of the span in ctx. It falls back to the global tracer provider when
+// ctx does not come from a traced server. The span kind can be overridden by opts.
+func StartSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	var tracer trace.Tracer
+	if tc := internal.TraceCarrierFromContext(ctx); tc != nil {
+		tracer = tc.Tracer()
+	}
+	if tracer == nil {
+		tracer = otel.GetTracerProvider().Tracer(
+			instrumentationName,
+			trace.WithInstrumentationVersion(SemVersion()),
+		)
+	}
+
+	return tracer.Start(ctx, name, append([]trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindInternal)}, opts...)...)
+}
+
+// SpanFromRequestContext returns the server span of the request started by ServerMiddleware,
+// or a non-recording span if the request is not traced.
+func SpanFromRequestContext(c *app.RequestContext) trace.Span {
+	if v, ok := c.Get(serverSpanKey); ok {
+		if span, ok := v.(trace.Span); ok {
+			return span
+		}
+	}
+	return trace.SpanFromContext(context.Background())
+}
+
+// SetSpanAttributes sets attributes on the server span of the request.
+func SetSpanAttributes(c *app.RequestContext, attrs ...attribute.KeyValue) {
+	SpanFromRequestContext(c).SetAttributes(attrs...)
+}
+
+// AddSpanEvent adds an event to the server span of the request.
+func AddSpanEvent(c *app.RequestContext, name string, opts ...trace.EventOption) {
+	SpanFromRequestContext(c).AddEvent(name, opts...)
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// ServerStatusMapperFunc maps the response status code of a server request to the span status
+type ServerStatusMapperFunc func(c *app.RequestContext, statusCode int) (codes.Code, string)
+
+// ClientStatusMapperFunc maps the response status code of a client request to the span status
+type ClientStatusMapperFunc func(req *protocol.Request, statusCode int) (codes.Code, string)
+
+// DefaultServerStatusMapper leaves the span status unset for 1xx-4xx status codes,
+// 4xx are client errors and must not mark the server span as error.
+// Ref to https://github.com/open-telemetry/opentelemetry-specification/blob/v1.20.0/specification/trace/semantic_conventions/http.md#status
+func DefaultServerStatusMapper(_ *app.RequestContext, statusCode int) (codes.Code, string) {
+	if statusCode < 100 || statusCode >= 600 {
+		return codes.Error, fmt.Sprintf("Invalid HTTP status code %d", statusCode)
+	}
+	if statusCode >= 500 {
+		return codes.Error, ""
+	}
+	return codes.Unset, ""
+}
+
+// DefaultClientStatusMapper leaves the span status unset for 1xx-3xx status codes.
+// Ref to https://github.com/open-telemetry/opentelemetry-specification/blob/v1.20.0/specification/trace/semantic_conventions/http.md#status
+func DefaultClientStatusMapper(_ *protocol.Request, statusCode int) (codes.Code, string) {
+	if statusCode < 100 || statusCode >= 600 {
+		return codes.Error, fmt.Sprintf("Invalid HTTP status code %d", statusCode)
+	}
+	if statusCode >= 400 {
+		return codes.Error, ""
+	}
+	return codes.Unset, ""
+}
+
+func (cfg *Config) serverSpanStatus(c *app.RequestContext) (codes.Code, string) {
+	statusCode := c.Response.StatusCode()
+	if _, ok := cfg.nonErrorStatusCodes[statusCode]; ok {
+		return codes.Unset, ""
+	}
+	return cfg.serverStatusMapper(c, statusCode)
+}
+
+// classifyError reports whether err marks the server span as error, the errors attached with
+// c.Error only mark it if the status mapping does, so a 4xx response with an error is not an error.
+func (cfg *Config) classifyError(ctx context.Context, c *app.RequestContext, err error, panicked bool) bool {
+	if cfg.errorClassifier != nil {
+		return cfg.errorClassifier(ctx, c, err)
+	}
+	if panicked {
+		return true
+	}
+	if last := c.Errors.Last(); last != nil && err == error(last) {
+		code, _ := cfg.serverSpanStatus(c)
+		return code == codes.Error
+	}
+	return true
+}
+
+func (cfg *Config) clientSpanStatus(req *protocol.Request, resp *protocol.Response) (codes.Code, string) {
+	statusCode := resp.StatusCode()
+	if _, ok := cfg.nonErrorStatusCodes[statusCode]; ok {
+		return codes.Unset, ""
+	}
+	return cfg.clientStatusMapper(req, statusCode)
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestDefaultStatusMappers(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		server     codes.Code
+		client     codes.Code
+	}{
+		{statusCode: 200, server: codes.Unset, client: codes.Unset},
+		{statusCode: 302, server: codes.Unset, client: codes.Unset},
+		{statusCode: 404, server: codes.Unset, client: codes.Error},
+		{statusCode: 429, server: codes.Unset, client: codes.Error},
+		{statusCode: 500, server: codes.Error, client: codes.Error},
+		{statusCode: 600, server: codes.Error, client: codes.Error},
+	}
+	for _, tt := range tests {
+		server, _ := DefaultServerStatusMapper(nil, tt.statusCode)
+		client, _ := DefaultClientStatusMapper(nil, tt.statusCode)
+		assert.Equal(t, tt.server, server, "server status of %d", tt.statusCode)
+		assert.Equal(t, tt.client, client, "client status of %d", tt.statusCode)
+	}
+}
+
+func TestNonErrorStatusCodes(t *testing.T) {
+	cfg := newConfig([]Option{WithNonErrorStatusCodes(404, 503)})
+
+	req, resp := &protocol.Request{}, &protocol.Response{}
+	resp.SetStatusCode(404)
+	code, _ := cfg.clientSpanStatus(req, resp)
+	assert.Equal(t, codes.Unset, code)
+
+	c := app.NewContext(0)
+	c.Response.SetStatusCode(503)
+	code, _ = cfg.serverSpanStatus(c)
+	assert.Equal(t, codes.Unset, code)
+
+	c.Response.SetStatusCode(500)
+	code, _ = cfg.serverSpanStatus(c)
+	assert.Equal(t, codes.Error, code)
+}
+
+func TestCustomServerStatusMapper(t *testing.T) {
+	cfg := newConfig([]Option{WithServerStatusMapper(func(c *app.RequestContext, statusCode int) (codes.Code, string) {
+		// a missing resource on the admin API is a broken deployment
+		if statusCode == 404 && string(c.Path()) == "/admin" {
+			return codes.Error, "admin route not found"
+		}
+		return DefaultServerStatusMapper(c, statusCode)
+	})})
+
+	c := app.NewContext(0)
+	c.Request.SetRequestURI("/admin")
+	c.Response.SetStatusCode(404)
+	code, _ := cfg.serverSpanStatus(c)
+	assert.Equal(t, codes.Error, code)
+
+	c.Request.SetRequestURI("/lookup")
+	code, _ = cfg.serverSpanStatus(c)
+	assert.Equal(t, codes.Unset, code)
+}
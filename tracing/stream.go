@@ -0,0 +1,214 @@
+// Copyright 2022 CloudWeGo Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/network"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Stream kinds of server responses.
+const (
+	StreamKindChunked   = "chunked"
+	StreamKindSSE       = "sse"
+	StreamKindWebSocket = "websocket"
+	StreamKindHijacked  = "hijacked"
+)
+
+var eventStreamContentType = []byte("text/event-stream")
+
+// streamKind returns the stream kind of the response, or an empty string
+// for ordinary responses. Hertz clears the hijack handler before finishing
+// the trace, so a hijacked connection is detected by the recorder or the
+// switching protocols status code.
+func streamKind(c *app.RequestContext, recorder *streamRecorder) string {
+	if c.Hijacked() || (recorder != nil && recorder.isHijacked()) || c.Response.StatusCode() == consts.StatusSwitchingProtocols {
+		if bytes.EqualFold(c.Request.Header.Peek("Upgrade"), []byte("websocket")) {
+			return StreamKindWebSocket
+		}
+		return StreamKindHijacked
+	}
+	if bytes.HasPrefix(c.Response.Header.ContentType(), eventStreamContentType) {
+		return StreamKindSSE
+	}
+	if c.Response.GetHijackWriter() != nil {
+		return StreamKindChunked
+	}
+	return ""
+}
+
+// streamRecorder records the messages of a streaming response as span events,
+// the number of events is bounded by the configured limit.
+type streamRecorder struct {
+	span      trace.Span
+	maxEvents int
+
+	mu            sync.Mutex
+	hijacked      bool
+	events        int
+	droppedEvents int
+	sent          int
+	received      int
+	sentBytes     int
+	receivedBytes int
+	pendingBytes  int
+	firstByte     time.Time
+}
+
+func newStreamRecorder(span trace.Span, maxEvents int) *streamRecorder {
+	return &streamRecorder{span: span, maxEvents: maxEvents}
+}
+
+func (r *streamRecorder) setHijacked() {
+	r.mu.Lock()
+	r.hijacked = true
+	r.mu.Unlock()
+}
+
+func (r *streamRecorder) isHijacked() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.hijacked
+}
+
+// write accumulates bytes of the message being written until the next flush.
+func (r *streamRecorder) write(n int) {
+	r.mu.Lock()
+	r.pendingBytes += n
+	r.mu.Unlock()
+}
+
+// flush records a sent message with the bytes written since the last flush.
+func (r *streamRecorder) flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pendingBytes == 0 {
+		return
+	}
+	size := r.pendingBytes
+	r.pendingBytes = 0
+	r.sent++
+	r.sentBytes += size
+
+	if r.firstByte.IsZero() {
+		r.firstByte = time.Now()
+		r.addEvent("stream_first_byte", trace.WithTimestamp(r.firstByte))
+	}
+	r.addEvent("message", trace.WithAttributes(
+		semconv.MessageTypeSent,
+		semconv.MessageIDKey.Int(r.sent),
+		semconv.MessageUncompressedSizeKey.Int(size),
+	))
+}
+
+// read records a received message.
+func (r *streamRecorder) read(n int) {
+	if n <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.received++
+	r.receivedBytes += n
+	r.addEvent("message", trace.WithAttributes(
+		semconv.MessageTypeReceived,
+		semconv.MessageIDKey.Int(r.received),
+		semconv.MessageUncompressedSizeKey.Int(n),
+	))
+}
+
+func (r *streamRecorder) addEvent(name string, opts ...trace.EventOption) {
+	if r.events >= r.maxEvents {
+		r.droppedEvents++
+		return
+	}
+	r.events++
+	r.span.AddEvent(name, opts...)
+}
+
+// attributes returns the summary of the stream.
+func (r *streamRecorder) attributes() []attribute.KeyValue {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attrs := []attribute.KeyValue{
+		StreamSentMessagesKey.Int(r.sent),
+		StreamReceivedMessagesKey.Int(r.received),
+		StreamSentBytesKey.Int(r.sentBytes),
+		StreamReceivedBytesKey.Int(r.receivedBytes),
+	}
+	if r.droppedEvents > 0 {
+		attrs = append(attrs, StreamDroppedEventsKey.Int(r.droppedEvents))
+	}
+	return attrs
+}
+
+// streamConn wraps the connection of a request, so the chunks flushed by a
+// hijacked response writer and the data exchanged over a hijacked connection
+// are recorded.
+type streamConn struct {
+	network.Conn
+	recorder *streamRecorder
+}
+
+func (c *streamConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.recorder.write(n)
+	c.recorder.flush()
+	return n, err
+}
+
+func (c *streamConn) Malloc(n int) ([]byte, error) {
+	buf, err := c.Conn.Malloc(n)
+	if err == nil {
+		c.recorder.write(n)
+	}
+	return buf, err
+}
+
+func (c *streamConn) WriteBinary(b []byte) (int, error) {
+	n, err := c.Conn.WriteBinary(b)
+	c.recorder.write(n)
+	return n, err
+}
+
+func (c *streamConn) Flush() error {
+	err := c.Conn.Flush()
+	c.recorder.flush()
+	return err
+}
+
+func (c *streamConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.recorder.read(n)
+	return n, err
+}
+
+func (c *streamConn) ReadBinary(n int) ([]byte, error) {
+	b, err := c.Conn.ReadBinary(n)
+	c.recorder.read(len(b))
+	return b, err
+}
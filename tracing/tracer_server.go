@@ -16,6 +16,7 @@ package tracing
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -23,11 +24,11 @@ import (
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/app/server"
-	"github.com/cloudwego/hertz/pkg/common/adaptor"
 	serverconfig "github.com/cloudwego/hertz/pkg/common/config"
 	"github.com/cloudwego/hertz/pkg/common/hlog"
 	"github.com/cloudwego/hertz/pkg/common/tracer"
 	"github.com/cloudwego/hertz/pkg/common/tracer/stats"
+	"github.com/cloudwego/hertz/pkg/common/tracer/traceinfo"
 	"github.com/hertz-contrib/obs-opentelemetry/tracing/internal"
 	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
 	oteltrace "go.opentelemetry.io/otel/trace"
@@ -36,22 +37,47 @@ import (
 var _ tracer.Tracer = (*serverTracer)(nil)
 
 type serverTracer struct {
-	config            *Config
-	counters          map[string]metric.Int64Counter
-	histogramRecorder map[string]metric.Float64Histogram
+	config *Config
+
+	requestCount   metric.Int64Counter
+	latency        metric.Float64Histogram
+	requestSize    metric.Float64Histogram
+	responseSize   metric.Float64Histogram
+	streamDuration metric.Float64Histogram
+	// timing holds the server timing histograms, nil unless enabled
+	timing []metric.Float64Histogram
+
+	metricsAttributes *metricsAttributesCache
+
+	// missingMiddleware warns once when ServerMiddleware is not registered
+	missingMiddleware sync.Once
 }
 
 func NewServerTracer(opts ...Option) (serverconfig.Option, *Config) {
 	cfg := newConfig(opts)
+	st := newServerTracer(cfg)
+	if !cfg.connectionMetrics {
+		return server.WithTracer(st), cfg
+	}
+
+	// keep the state of the connections for the connection metrics
+	measures := createConnMeasures(cfg.meter)
+	withTracer := server.WithTracer(st)
+	return serverconfig.Option{F: func(o *serverconfig.Options) {
+		withTracer.F(o)
+		o.OnAccept = measures.onAccept(o.OnAccept)
+	}}, cfg
+}
+
+func newServerTracer(cfg *Config) *serverTracer {
 	st := &serverTracer{
 		config:            cfg,
-		counters:          make(map[string]metric.Int64Counter),
-		histogramRecorder: make(map[string]metric.Float64Histogram),
+		metricsAttributes: newMetricsAttributesCache(),
 	}
 
 	st.createMeasures()
 
-	return server.WithTracer(st), cfg
+	return st
 }
 
 func (s *serverTracer) createMeasures() {
@@ -69,8 +95,36 @@ func (s *serverTracer) createMeasures() {
 	)
 	handleErr(err)
 
-	s.counters[ServerRequestCount] = serverRequestCountMeasure
-	s.histogramRecorder[ServerLatency] = serverLatencyMeasure
+	serverRequestSizeMeasure, err := s.config.meter.Float64Histogram(
+		ServerRequestSize,
+		metric.WithUnit("By"),
+		metric.WithDescription("measures the size of incoming request bodies"),
+	)
+	handleErr(err)
+
+	serverResponseSizeMeasure, err := s.config.meter.Float64Histogram(
+		ServerResponseSize,
+		metric.WithUnit("By"),
+		metric.WithDescription("measures the size of outgoing response bodies"),
+	)
+	handleErr(err)
+
+	serverStreamDurationMeasure, err := s.config.meter.Float64Histogram(
+		ServerStreamDuration,
+		metric.WithUnit("ms"),
+		metric.WithDescription("measures the duration of streaming responses and hijacked connections"),
+	)
+	handleErr(err)
+
+	s.requestCount = serverRequestCountMeasure
+	s.latency = serverLatencyMeasure
+	s.requestSize = serverRequestSizeMeasure
+	s.responseSize = serverResponseSizeMeasure
+	s.streamDuration = serverStreamDurationMeasure
+
+	if s.config.serverTimingMetrics {
+		s.timing = createServerTimingMeasures(s.config.meter)
+	}
 }
 
 func (s *serverTracer) Start(ctx context.Context, c *app.RequestContext) context.Context {
@@ -84,7 +138,9 @@ func (s *serverTracer) Start(ctx context.Context, c *app.RequestContext) context
 }
 
 func (s *serverTracer) Finish(ctx context.Context, c *app.RequestContext) {
-	if s.config.shouldIgnore(ctx, c) {
+	// the config of the route group which started the span, if any
+	cfg := requestConfig(c, s.config)
+	if cfg.shouldIgnore(ctx, c) {
 		return
 	}
 	// trace carrier from context
@@ -106,21 +162,36 @@ func (s *serverTracer) Finish(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
-	elapsedTime := float64(st.GetEvent(stats.HTTPFinish).Time().Sub(httpStart.Time())) / float64(time.Millisecond)
-
 	// span
 	span := tc.Span()
-	if span == nil || !span.IsRecording() {
+	if span == nil {
+		// ServerMiddleware is not registered, the span starts with the request
+		s.missingMiddleware.Do(func() {
+			hlog.Warnf("HERTZ: ServerMiddleware did not run, the server span is started by the tracer and is not available to the handlers, use tracing.Instrument or h.Use(tracing.ServerMiddleware(cfg)) as the first middleware")
+		})
+		_, span = startServerSpan(ctx, c, cfg, tc.Tracer(), httpStart.Time())
+	}
+
+	s.finish(ctx, c, cfg, tc, span, st, httpStart.Time(), getEndTimeOrNow(ti))
+}
+
+// finish ends the server span of the request and records the metrics, st is nil when the
+// server runs without the tracer and the request stats are not available.
+func (s *serverTracer) finish(ctx context.Context, c *app.RequestContext, cfg *Config, tc *internal.TraceCarrier,
+	span oteltrace.Span, st traceinfo.HTTPStats, start, end time.Time,
+) {
+	if !span.IsRecording() {
 		return
 	}
 
+	elapsedTime := float64(end.Sub(start)) / float64(time.Millisecond)
+
 	// span attributes from original http request
-	if httpReq, err := adaptor.GetCompatRequest(c.GetRequest()); err == nil {
-		span.SetAttributes(semconv.NetAttributesFromHTTPRequest("tcp", httpReq)...)
-		span.SetAttributes(semconv.EndUserAttributesFromHTTPRequest(httpReq)...)
-		span.SetAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", s.config.serverHttpRouteFormatter(c), httpReq)...)
-		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(c.Response.StatusCode()))
-	}
+	version, transport := serverProtocol(c)
+	span.SetAttributes(httpRequestAttributes(&c.Request, transport, version, cfg.serverHttpRouteFormatter(c))...)
+	span.SetAttributes(protocolAttributes(version, transport)...)
+	span.SetStatus(cfg.serverSpanStatus(c))
+	span.SetAttributes(cfg.headerAttributes(c)...)
 
 	// span attributes
 	attrs := []attribute.KeyValue{
@@ -128,20 +199,81 @@ func (s *serverTracer) Finish(ctx context.Context, c *app.RequestContext) {
 		semconv.NetPeerIPKey.String(c.ClientIP()),
 		semconv.HTTPStatusCodeKey.Int(c.Response.StatusCode()),
 	}
+
+	// body sizes and io errors
+	readBytes, wroteBytes := requestBodySize(&c.Request), responseBodySize(&c.Response)
+	if st != nil {
+		readBytes, wroteBytes = bodySizesFromStats(c, st)
+	}
+	if readBytes > 0 {
+		attrs = append(attrs, ReadBytesKey.Int(readBytes))
+	}
+	if wroteBytes > 0 {
+		attrs = append(attrs, WroteBytesKey.Int(wroteBytes))
+	}
+	if st != nil {
+		if readErr := statsEventError(st, stats.ReadHeaderFinish, stats.ReadBodyFinish); readErr != "" {
+			attrs = append(attrs, ReadErrorKey.String(readErr))
+		}
+		if writeErr := statsEventError(st, stats.WriteFinish); writeErr != "" {
+			attrs = append(attrs, WriteErrorKey.String(writeErr))
+		}
+	}
 	span.SetAttributes(attrs...)
 
-	injectStatsEventsToSpan(span, st)
+	// streaming responses and hijacked connections
+	var kind string
+	if cfg.streamTracing {
+		recorder, _ := tc.Stream().(*streamRecorder)
+		kind = streamKind(c, recorder)
+		if kind != "" {
+			span.SetAttributes(StreamKindKey.String(kind))
+			if recorder != nil {
+				span.SetAttributes(recorder.attributes()...)
+			}
+		}
+	}
+
+	if st != nil {
+		injectStatsEventsToSpan(span, st)
+	}
+
+	if cs := connStateFromContext(ctx); cs != nil {
+		span.SetAttributes(cs.requestFinished(start, end)...)
+	}
 
-	if panicMsg, panicStack, httpErr := parseHTTPError(ti); httpErr != nil || len(panicMsg) > 0 {
-		recordErrorSpanWithStack(span, httpErr, panicMsg, panicStack)
+	if httpErr, panicked := parseHTTPError(c); httpErr != nil {
+		var errAttrs []attribute.KeyValue
+		if cfg.errorAttributes != nil {
+			errAttrs = cfg.errorAttributes(ctx, c, httpErr)
+			span.SetAttributes(errAttrs...)
+		}
+		recordErrorSpanWithStack(span, httpErr, panicked, cfg.classifyError(ctx, c, httpErr, panicked), errAttrs...)
 	}
 
 	// Extract metrics attributes before span.End() to avoid data race
 	// with the exporter which may process the span in another goroutine.
-	metricsAttributes := extractMetricsAttributesFromSpan(span)
+	recorded := span
+	if dropped, ok := span.(*droppedSpan); ok {
+		recorded = dropped.Span
+	}
+	metricsAttributes := s.metricsAttributes.measurementOption(recorded)
+
+	span.End(oteltrace.WithTimestamp(end))
 
-	span.End(oteltrace.WithTimestamp(getEndTimeOrNow(ti)))
+	// record metrics with the span context, so the exemplars link to the trace
+	ctx = oteltrace.ContextWithSpan(ctx, span)
 
-	s.counters[ServerRequestCount].Add(ctx, 1, metric.WithAttributes(metricsAttributes...))
-	s.histogramRecorder[ServerLatency].Record(ctx, elapsedTime, metric.WithAttributes(metricsAttributes...))
+	s.requestCount.Add(ctx, 1, metricsAttributes)
+	if kind != "" {
+		s.streamDuration.Record(ctx, elapsedTime, metricsAttributes, metric.WithAttributes(StreamKindKey.String(kind)))
+	} else {
+		s.latency.Record(ctx, elapsedTime, metricsAttributes)
+	}
+	s.requestSize.Record(ctx, float64(readBytes), metricsAttributes)
+	s.responseSize.Record(ctx, float64(wroteBytes), metricsAttributes)
+
+	if s.timing != nil && st != nil {
+		recordServerTimingMetrics(ctx, s.timing, st, metricsAttributes)
+	}
 }
@@ -15,12 +15,15 @@
 package tracing
 
 import (
-	"errors"
-	"fmt"
+	"io"
+	"reflect"
 	"time"
 
+	"github.com/cloudwego/hertz/pkg/app"
+	hertzerrors "github.com/cloudwego/hertz/pkg/common/errors"
 	"github.com/cloudwego/hertz/pkg/common/tracer/stats"
 	"github.com/cloudwego/hertz/pkg/common/tracer/traceinfo"
+	"github.com/cloudwego/hertz/pkg/protocol"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -35,6 +38,9 @@ func handleErr(err error) {
 }
 
 func getStartTimeOrNow(ti traceinfo.TraceInfo) time.Time {
+	if ti == nil {
+		return time.Now()
+	}
 	if event := ti.Stats().GetEvent(stats.HTTPStart); event != nil {
 		return event.Time()
 	}
@@ -62,39 +68,133 @@ func getServiceFromResourceAttributes(attrs []attribute.KeyValue) (serviceName,
 	return
 }
 
-func parseHTTPError(ri traceinfo.TraceInfo) (panicMsg, panicStack string, err error) {
-	panicked, panicErr := ri.Stats().Panicked()
-	if err = ri.Stats().Error(); err == nil && !panicked {
-		return
+// parseHTTPError returns the error of the request, a panic takes precedence
+// over the stats error and the errors attached to the request context.
+func parseHTTPError(c *app.RequestContext) (err error, panicked bool) {
+	// the trace info is nil when the server runs without tracers
+	if ti := c.GetTraceInfo(); ti != nil {
+		st := ti.Stats()
+		if isPanicked, panicErr := st.Panicked(); isPanicked {
+			if pe, ok := panicErr.(*panicError); ok {
+				return pe, true
+			}
+			pe := &panicError{value: panicErr}
+			if stackErr, ok := panicErr.(interface{ Stack() string }); ok {
+				pe.stack = stackErr.Stack()
+			}
+			return pe, true
+		}
+		if err = st.Error(); err != nil {
+			return err, false
+		}
 	}
-	if panicked {
-		panicMsg = fmt.Sprintf("%v", panicErr)
-		if stackErr, ok := panicErr.(interface{ Stack() string }); ok {
-			panicStack = stackErr.Stack()
+	if last := c.Errors.Last(); last != nil {
+		if pe, ok := last.Err.(*panicError); ok {
+			return pe, true
 		}
+		return last, false
 	}
-	return
+	return nil, false
 }
 
-// recordErrorSpanWithStack record error with stack
-func recordErrorSpanWithStack(span trace.Span, err error, stackMessage, stackTrace string, attributes ...attribute.KeyValue) {
-	if span == nil {
+// recordErrorSpanWithStack records err as an exception event, and marks the span as error
+// if markError is true
+func recordErrorSpanWithStack(span trace.Span, err error, escaped, markError bool, attributes ...attribute.KeyValue) {
+	if span == nil || err == nil {
 		return
 	}
 
-	// compatible with the case where error is empty
-	if err == nil {
-		err = errors.New(stackMessage)
+	if markError {
+		span.SetStatus(codes.Error, err.Error())
 	}
+	recordException(span, err, escaped, attributes...)
+}
 
-	// stack trace
+// recordException adds an exception event following the exception semantic conventions.
+func recordException(span trace.Span, err error, escaped bool, attributes ...attribute.KeyValue) {
 	attributes = append(attributes,
-		semconv.ExceptionStacktraceKey.String(stackTrace),
+		semconv.ExceptionTypeKey.String(exceptionType(err)),
+		semconv.ExceptionMessageKey.String(err.Error()),
+		semconv.ExceptionEscapedKey.Bool(escaped),
 	)
 
-	span.SetStatus(codes.Error, err.Error())
-	span.RecordError(
-		err,
-		trace.WithAttributes(attributes...),
-	)
+	// stack trace
+	if stackErr, ok := err.(interface{ Stack() string }); ok && stackErr.Stack() != "" {
+		attributes = append(attributes, semconv.ExceptionStacktraceKey.String(stackErr.Stack()))
+	}
+
+	span.AddEvent(semconv.ExceptionEventName, trace.WithAttributes(attributes...))
+}
+
+// exceptionType returns the type name of the panic value or the underlying error.
+func exceptionType(err error) string {
+	var v interface{} = err
+	switch e := err.(type) {
+	case *panicError:
+		v = e.value
+	case *hertzerrors.Error:
+		if e.Err != nil {
+			v = e.Err
+		}
+	}
+	if v == nil {
+		return "nil"
+	}
+
+	t := reflect.TypeOf(v)
+	if t.PkgPath() == "" && t.Name() == "" {
+		// pointers and other unnamed types
+		return t.String()
+	}
+	if t.PkgPath() == "" {
+		return t.Name()
+	}
+	return t.PkgPath() + "." + t.Name()
+}
+
+// bodySizesFromStats returns the request and response body sizes, the sizes in
+// hertz stats include the headers, so the header lengths are subtracted.
+func bodySizesFromStats(c *app.RequestContext, st traceinfo.HTTPStats) (readBytes, wroteBytes int) {
+	if readBytes = st.RecvSize() - len(c.Request.Header.RawHeaders()); readBytes < 0 {
+		readBytes = 0
+	}
+	if wroteBytes = st.SendSize() - c.Response.Header.GetHeaderLength(); wroteBytes < 0 {
+		wroteBytes = 0
+	}
+	return
+}
+
+// statsEventError returns the error info of the first failed event, io.EOF is not recorded.
+func statsEventError(st traceinfo.HTTPStats, events ...stats.Event) string {
+	for _, event := range events {
+		gotEvent := st.GetEvent(event)
+		if gotEvent == nil || gotEvent.Status() != stats.StatusError {
+			continue
+		}
+		if info := gotEvent.Info(); info != "" && info != io.EOF.Error() {
+			return info
+		}
+	}
+	return ""
+}
+
+func requestBodySize(req *protocol.Request) int {
+	if req.IsBodyStream() {
+		return nonNegative(req.Header.ContentLength())
+	}
+	return len(req.Body())
+}
+
+func responseBodySize(resp *protocol.Response) int {
+	if resp.IsBodyStream() {
+		return nonNegative(resp.Header.ContentLength())
+	}
+	return len(resp.Body())
+}
+
+func nonNegative(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
 }